@@ -2,13 +2,41 @@
 // Use of this source code is governed by a license that can be
 // found in the LICENSE file.
 
+//go:build amd64 && !gccgo && !appengine
 // +build amd64,!gccgo,!appengine
 
 package siv
 
+import "golang.org/x/sys/cpu"
+
+// cpuBackend returns the fastest backend supported by the CPU.
+func cpuBackend() Backend {
+	switch {
+	case cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ:
+		return BackendAESNIPCLMUL
+	case cpu.X86.HasAES:
+		return BackendAESNI
+	default:
+		return BackendGeneric
+	}
+}
+
 // keySchedule performs an AES key-schedule and is implemented in aes_amd64.s
 func keySchedule(keys, key []byte)
 
 // encryptBlock encrypts one 128 bit block from src to dst using AES and is
 // implemented in aes_amd64.s
 func encryptBlock(dst, src, keys []byte, keyLen uint64)
+
+// aesBlock is a cipher.Block using the key schedule computed
+// by keySchedule. It only supports encryption.
+type aesBlock struct {
+	keys   []byte
+	keyLen int
+}
+
+func (b *aesBlock) BlockSize() int { return 16 }
+
+func (b *aesBlock) Encrypt(dst, src []byte) { encryptBlock(dst, src, b.keys, uint64(b.keyLen)) }
+
+func (b *aesBlock) Decrypt(dst, src []byte) { panic("siv: AES decryption is not supported") }
@@ -6,11 +6,11 @@
 
 #include "aes_macros_amd64.s"
 
-// func keySchedule(keys []uint32, key []byte)
+// func keySchedule(keys, key []byte)
 TEXT ·keySchedule(SB), 4, $0-48
 	MOVQ keys+0(FP), AX
 	MOVQ key+24(FP), BX
-	MOVQ keyLen+32(FP), DX
+	MOVQ key_len+32(FP), DX
 
 	CMPQ DX, $24
 	JE   aes_192
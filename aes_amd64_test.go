@@ -0,0 +1,61 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+//go:build amd64 && !gccgo && !appengine
+// +build amd64,!gccgo,!appengine
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+
+	"golang.org/x/sys/cpu"
+)
+
+// TestAssemblerUnaligned checks that the assembler implementations
+// accept inputs and outputs that do not start at a 16 byte aligned
+// address - e.g. sub-slices of a larger buffer.
+func TestAssemblerUnaligned(t *testing.T) {
+	if !cpu.X86.HasAES || !cpu.X86.HasPCLMULQDQ {
+		t.Skip("No assembler implementation / AES hardware support")
+	}
+	for offset := 0; offset < 16; offset++ {
+		testAssemblerUnaligned(t, "AES-SIV-CMAC", NewCMAC, make([]byte, 32), 16, offset)
+		testAssemblerUnaligned(t, "AES-GCM-SIV", NewGCM, make([]byte, 16), 12, offset)
+	}
+}
+
+func testAssemblerUnaligned(t *testing.T, name string, newAEAD func([]byte) (cipher.AEAD, error), key []byte, nonceSize, offset int) {
+	unaligned := func(n int) []byte {
+		b := make([]byte, n+offset)[offset:]
+		for i := range b {
+			b[i] = byte(i)
+		}
+		return b
+	}
+	plaintext, additionalData, nonce := unaligned(515), unaligned(100), unaligned(nonceSize)
+
+	c, err := newAEAD(key)
+	if err != nil {
+		t.Fatalf("%s: failed to create AEAD: %v", name, err)
+	}
+	ciphertext := c.Seal(unaligned(len(plaintext) + c.Overhead())[:0], nonce, plaintext, additionalData)
+	decrypted, err := c.Open(unaligned(len(plaintext))[:0], nonce, ciphertext, additionalData)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("%s: offset %d: Open failed: %v", name, offset, err)
+	}
+
+	hasAES := cpu.X86.HasAES
+	cpu.X86.HasAES = false // Disable AES assembler implementations
+	ref, err := newAEAD(key)
+	cpu.X86.HasAES = hasAES
+	if err != nil {
+		t.Fatalf("%s: failed to create AEAD: %v", name, err)
+	}
+	if refCiphertext := ref.Seal(nil, nonce, plaintext, additionalData); !bytes.Equal(refCiphertext, ciphertext) {
+		t.Fatalf("%s: offset %d: ciphertext mismatch", name, offset)
+	}
+}
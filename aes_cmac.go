@@ -7,6 +7,7 @@ package siv
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"errors"
 )
 
 // NewCMAC returns a cipher.AEAD implementing AES-SIV-CMAC
@@ -15,13 +16,60 @@ import (
 //
 // The returned cipher.AEAD accepts an empty or NonceSize()
 // bytes long nonce.
+//
+// The additional data and the nonce are passed to S2V as two
+// components - in this order. Empty additional data is omitted
+// if the nonce is empty as well. Then, S2V is computed over the
+// plaintext only. This deviates from implementations that always
+// pass the additional data as one - possibly empty - component,
+// like OpenSSL and the Wycheproof test vectors. Hence, ciphertexts
+// without nonce and additional data are not interoperable with
+// them.
 func NewCMAC(key []byte) (cipher.AEAD, error) {
 	if k := len(key); k != 32 && k != 48 && k != 64 {
 		return nil, aes.KeySizeError(k)
 	}
-	return &aesSivCMac{newCMAC(key)}, nil
+	if err := checkSelfTest(); err != nil {
+		return nil, err
+	}
+	backend, err := selectBackend()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCMAC(key, backend, true)
+	if err != nil {
+		return nil, err
+	}
+	return &aesSivCMac{c}, nil
 }
 
+// NewCMACFromBlocks returns a cipher.AEAD implementing the
+// SIV-CMAC construction of RFC 5297 using an arbitrary 128 bit
+// block cipher. The macBlock is used by S2V - the CMAC-based
+// PRF - and the ctrBlock is used for CTR mode encryption.
+// Both must be keyed with independent keys.
+//
+// The additional data is passed to S2V as described by NewCMAC.
+// NewCMACFromBlocks always uses the generic implementation.
+// Use NewCMAC for AES.
+func NewCMACFromBlocks(macBlock, ctrBlock cipher.Block) (cipher.AEAD, error) {
+	if macBlock.BlockSize() != aes.BlockSize || ctrBlock.BlockSize() != aes.BlockSize {
+		return nil, errBlockSize
+	}
+	if err := checkSelfTest(); err != nil {
+		return nil, err
+	}
+	c, err := newCMACFromBlocks(macBlock, ctrBlock, true)
+	if err != nil {
+		return nil, err
+	}
+	return &aesSivCMac{c}, nil
+}
+
+var errBlockSize = errors.New("siv: block cipher must have a block size of 128 bits")
+
+var _ Destroyer = (*aesSivCMac)(nil)
+
 type aesSivCMac struct{ aead }
 
 func (c *aesSivCMac) NonceSize() int { return aes.BlockSize }
@@ -32,6 +80,9 @@ func (c *aesSivCMac) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 	if n := len(nonce); n != 0 && n != c.NonceSize() {
 		panic("siv: incorrect nonce length given to AES-SIV-CMAC")
 	}
+	if c.aead == nil {
+		panic(ErrDestroyed)
+	}
 	ret, ciphertext := sliceForAppend(dst, c.Overhead()+len(plaintext))
 	c.seal(ciphertext, nonce, plaintext, additionalData)
 	return ret
@@ -41,6 +92,9 @@ func (c *aesSivCMac) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte
 	if n := len(nonce); n != 0 && n != c.NonceSize() {
 		panic("siv: incorrect nonce length given to AES-SIV-CMAC")
 	}
+	if c.aead == nil {
+		return nil, ErrDestroyed
+	}
 	if len(ciphertext) < c.Overhead() {
 		return dst, errOpen
 	}
@@ -50,3 +104,11 @@ func (c *aesSivCMac) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte
 	}
 	return ret, nil
 }
+
+// Destroy wipes all key material. See Destroyer.
+func (c *aesSivCMac) Destroy() {
+	if c.aead != nil {
+		c.aead.destroy()
+		c.aead = nil
+	}
+}
@@ -2,48 +2,73 @@
 // Use of this source code is governed by a license that can be
 // found in the LICENSE file.
 
+//go:build amd64 && !gccgo && !appengine
 // +build amd64,!gccgo,!appengine
 
 package siv
 
 import (
 	"crypto/subtle"
-	"hash"
-
-	cmac "github.com/aead/cmac/aes"
-	"golang.org/x/sys/cpu"
+	"runtime"
 )
 
 func aesCMacXORKeyStream(dst, src, iv, keys []byte, keyLen uint64)
 
-func newCMAC(key []byte) aead {
-	if cpu.X86.HasAES {
-		cmac, _ := cmac.New(key[:len(key)/2])
-		key = key[len(key)/2:]
-		keys := make([]byte, 4*(28+len(key)))
-		keySchedule(keys, key)
-		return &aesSivCMacAsm{
-			cmac:      cmac,
+func newCMAC(key []byte, backend Backend, secure bool) (aead, error) {
+	if cmacBackend(backend) == BackendAESNI {
+		n := len(key) / 2
+		scheduleSize := 4 * (28 + n)
+		mem, err := newKeyBuffer(2*scheduleSize+32, secure)
+		if err != nil {
+			return nil, err
+		}
+		macKeys, keys, subkeys := mem.data[:scheduleSize], mem.data[scheduleSize:2*scheduleSize], mem.data[2*scheduleSize:]
+		keySchedule(macKeys, key[:n])
+		keySchedule(keys, key[n:])
+		c := &aesSivCMacAsm{
+			cmac:      newCMACHash(&aesBlock{keys: macKeys, keyLen: n}, subkeys),
 			keys:      keys,
-			keyLength: len(key),
+			keyLength: n,
+			mem:       mem,
+		}
+		if err = mem.protect(); err != nil {
+			c.destroy()
+			return nil, err
 		}
+		return c, nil
 	}
-	return newCMACGeneric(key)
+	return newCMACGeneric(key, secure)
 }
 
 type aesSivCMacAsm struct {
-	cmac      hash.Hash
+	cmac      *cmacHash
 	keys      []byte
 	keyLength int
+	mem       *keyBuffer
+}
+
+func (c *aesSivCMacAsm) backend() Backend { return BackendAESNI }
+
+func (c *aesSivCMacAsm) destroy() {
+	c.cmac.destroy()
+	c.keys = nil
+	c.mem.free()
 }
 
 func (c *aesSivCMacAsm) seal(ciphertext, nonce, plaintext, additionalData []byte) {
 	v := s2vGeneric(additionalData, nonce, plaintext, c.cmac)
-	copy(ciphertext, v[:])
-	ciphertext = ciphertext[len(v):]
 
+	// The plaintext may share its memory with the ciphertext - e.g.
+	// Seal(plaintext[:0], ...). Therefore, move the plaintext to its
+	// position within the ciphertext before writing the tag.
+	copy(ciphertext[len(v):], plaintext)
 	iv := newIV(v)
-	aesCMacXORKeyStream(ciphertext, plaintext, iv[:], c.keys, uint64(c.keyLength))
+	aesCMacXORKeyStream(ciphertext[len(v):], ciphertext[len(v):], iv[:], c.keys, uint64(c.keyLength))
+	copy(ciphertext, v[:])
+
+	// The key schedules live in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
 }
 
 func (c *aesSivCMacAsm) open(plaintext, nonce, ciphertext, additionalData []byte) error {
@@ -52,9 +77,14 @@ func (c *aesSivCMacAsm) open(plaintext, nonce, ciphertext, additionalData []byte
 	ciphertext = ciphertext[len(v):]
 
 	iv := newIV(v)
-	aesCMacXORKeyStream(plaintext, ciphertext, iv[:], c.keys, uint64(c.keyLength))
+	copy(plaintext, ciphertext) // plaintext may share its memory with ciphertext
+	aesCMacXORKeyStream(plaintext, plaintext, iv[:], c.keys, uint64(c.keyLength))
 
 	tag := s2vGeneric(additionalData, nonce, plaintext, c.cmac)
+
+	// The key schedules live in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
 	if subtle.ConstantTimeCompare(v[:], tag[:]) != 1 {
 		for i := range plaintext {
 			plaintext[i] = 0
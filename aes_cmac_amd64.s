@@ -74,14 +74,22 @@ aes_128_8:
 	AES_128_8(X0, X1, X2, X3, X4, X5, X6, X7, X8, AX)
 
 xor_8:
-	PXOR   (0 * 16)(SI), X0
-	PXOR   (1 * 16)(SI), X1
-	PXOR   (2 * 16)(SI), X2
-	PXOR   (3 * 16)(SI), X3
-	PXOR   (4 * 16)(SI), X4
-	PXOR   (5 * 16)(SI), X5
-	PXOR   (6 * 16)(SI), X6
-	PXOR   (7 * 16)(SI), X7
+	MOVUPS (0 * 16)(SI), X8
+	PXOR   X8, X0
+	MOVUPS (1 * 16)(SI), X8
+	PXOR   X8, X1
+	MOVUPS (2 * 16)(SI), X8
+	PXOR   X8, X2
+	MOVUPS (3 * 16)(SI), X8
+	PXOR   X8, X3
+	MOVUPS (4 * 16)(SI), X8
+	PXOR   X8, X4
+	MOVUPS (5 * 16)(SI), X8
+	PXOR   X8, X5
+	MOVUPS (6 * 16)(SI), X8
+	PXOR   X8, X6
+	MOVUPS (7 * 16)(SI), X8
+	PXOR   X8, X7
 	MOVUPS X0, (0 * 16)(DI)
 	MOVUPS X1, (1 * 16)(DI)
 	MOVUPS X2, (2 * 16)(DI)
@@ -126,10 +134,14 @@ aes_128_4:
 	AES_128_4(X0, X1, X2, X3, X4, AX)
 
 xor_4:
-	PXOR   (0 * 16)(SI), X0
-	PXOR   (1 * 16)(SI), X1
-	PXOR   (2 * 16)(SI), X2
-	PXOR   (3 * 16)(SI), X3
+	MOVUPS (0 * 16)(SI), X4
+	PXOR   X4, X0
+	MOVUPS (1 * 16)(SI), X4
+	PXOR   X4, X1
+	MOVUPS (2 * 16)(SI), X4
+	PXOR   X4, X2
+	MOVUPS (3 * 16)(SI), X4
+	PXOR   X4, X3
 	MOVUPS X0, (0 * 16)(DI)
 	MOVUPS X1, (1 * 16)(DI)
 	MOVUPS X2, (2 * 16)(DI)
@@ -162,7 +174,8 @@ aes_128_1:
 xor_1:
 	CMPQ   DX, $16
 	JB     finalize
-	PXOR   0(SI), X0
+	MOVUPS 0(SI), X1
+	PXOR   X1, X0
 	MOVUPS X0, 0(DI)
 	INC_COUNTER(R8, R9)
 	ADDQ   $16, SI
@@ -5,32 +5,68 @@
 package siv
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/subtle"
 	"hash"
-
-	cmac "github.com/aead/cmac/aes"
+	"runtime"
 )
 
-func newCMACGeneric(key []byte) aead {
-	cmac, _ := cmac.New(key[:len(key)/2])
-	block, _ := aes.NewCipher(key[len(key)/2:])
-	return &aesSivCMacGeneric{cmac: cmac, block: block}
+func newCMACGeneric(key []byte, secure bool) (aead, error) {
+	n := len(key) / 2
+	scheduleSize := 4 * (28 + n)
+	mem, err := newKeyBuffer(2*scheduleSize+32, secure)
+	if err != nil {
+		return nil, err
+	}
+	macKeys, keys, subkeys := mem.data[:scheduleSize], mem.data[scheduleSize:2*scheduleSize], mem.data[2*scheduleSize:]
+	expandKeyGeneric(macKeys, key[:n])
+	expandKeyGeneric(keys, key[n:])
+	c := &aesSivCMacGeneric{
+		cmac:  newCMACHash(&aesGeneric{keys: macKeys}, subkeys),
+		block: &aesGeneric{keys: keys},
+		mem:   mem,
+	}
+	if err = mem.protect(); err != nil {
+		c.destroy()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newCMACFromBlocks(macBlock, block cipher.Block, secure bool) (aead, error) {
+	mem, err := newKeyBuffer(32, secure)
+	if err != nil {
+		return nil, err
+	}
+	c := &aesSivCMacGeneric{cmac: newCMACHash(macBlock, mem.data), block: block, mem: mem}
+	if err = mem.protect(); err != nil {
+		c.destroy()
+		return nil, err
+	}
+	return c, nil
 }
 
 type aesSivCMacGeneric struct {
-	cmac  hash.Hash
+	cmac  *cmacHash
 	block cipher.Block
+	mem   *keyBuffer
 }
 
 func (c *aesSivCMacGeneric) seal(ciphertext, nonce, plaintext, additionalData []byte) {
 	v := s2vGeneric(additionalData, nonce, plaintext, c.cmac)
-	copy(ciphertext, v[:])
 
+	// The plaintext may share its memory with the ciphertext - e.g.
+	// Seal(plaintext[:0], ...). Therefore, move the plaintext to its
+	// position within the ciphertext before writing the tag.
+	copy(ciphertext[len(v):], plaintext)
 	iv := newIV(v)
 	ctr := cipher.NewCTR(c.block, iv[:])
-	ctr.XORKeyStream(ciphertext[len(v):], plaintext)
+	ctr.XORKeyStream(ciphertext[len(v):], ciphertext[len(v):])
+	copy(ciphertext, v[:])
+
+	// The CMAC subkeys live in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
 }
 
 func (c *aesSivCMacGeneric) open(plaintext, nonce, ciphertext, additionalData []byte) error {
@@ -40,9 +76,15 @@ func (c *aesSivCMacGeneric) open(plaintext, nonce, ciphertext, additionalData []
 
 	iv := newIV(tag)
 	ctr := cipher.NewCTR(c.block, iv[:])
-	ctr.XORKeyStream(plaintext, ciphertext)
+	copy(plaintext, ciphertext) // plaintext may share its memory with ciphertext
+	ctr.XORKeyStream(plaintext, plaintext)
 
 	v := s2vGeneric(additionalData, nonce, plaintext, c.cmac)
+
+	// The CMAC subkeys live in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
+
 	if subtle.ConstantTimeCompare(v[:], tag[:]) != 1 {
 		for i := range plaintext {
 			plaintext[i] = 0
@@ -52,14 +94,40 @@ func (c *aesSivCMacGeneric) open(plaintext, nonce, ciphertext, additionalData []
 	return nil
 }
 
+func (c *aesSivCMacGeneric) backend() Backend { return BackendGeneric }
+
+func (c *aesSivCMacGeneric) destroy() {
+	c.cmac.destroy()
+	wipeBlock(c.block)
+	c.block = nil
+	c.mem.free()
+}
+
+// s2vGeneric computes S2V over the additional data, the nonce
+// and the plaintext. The additional data is omitted if both it
+// and the nonce are empty. The nonce is omitted if it is empty.
 func s2vGeneric(additionalData, nonce, plaintext []byte, mac hash.Hash) [16]byte {
+	switch {
+	case len(nonce) > 0:
+		return s2v(mac, plaintext, additionalData, nonce)
+	case len(additionalData) > 0:
+		return s2v(mac, plaintext, additionalData)
+	default:
+		return s2v(mac, plaintext)
+	}
+}
+
+// s2v computes S2V (RFC 5297, Section 2.4) over the
+// components - each of which may be empty - followed
+// by the plaintext.
+func s2v(mac hash.Hash, plaintext []byte, components ...[]byte) [16]byte {
 	var b0, b1 [16]byte
 	mac.Write(b0[:])
 	mac.Sum(b1[:0])
 	mac.Reset()
 
-	if len(additionalData) > 0 || len(nonce) > 0 {
-		mac.Write(additionalData)
+	for _, c := range components {
+		mac.Write(c)
 		mac.Sum(b0[:0])
 		mac.Reset()
 
@@ -67,19 +135,9 @@ func s2vGeneric(additionalData, nonce, plaintext []byte, mac hash.Hash) [16]byte
 		for i := range b1 {
 			b1[i] ^= b0[i]
 		}
-		if len(nonce) > 0 {
-			mac.Write(nonce)
-			mac.Sum(b0[:0])
-			mac.Reset()
-
-			dbl(&b1)
-			for i := range b1 {
-				b1[i] ^= b0[i]
-			}
-		}
-		for i := range b0 {
-			b0[i] = 0
-		}
+	}
+	for i := range b0 {
+		b0[i] = 0
 	}
 
 	if len(plaintext) >= 16 {
@@ -2,10 +2,11 @@
 // Use of this source code is governed by a license that can be
 // found in the LICENSE file.
 
+//go:build !amd64 || gccgo || appengine
 // +build !amd64 gccgo appengine
 
 package siv
 
-type aesSivCMacImpl = aesSivCMacGeneric
-
-func newCMAC(key []byte) aead { return newCMACGeneric(key) }
+func newCMAC(key []byte, backend Backend, secure bool) (aead, error) {
+	return newCMACGeneric(key, secure)
+}
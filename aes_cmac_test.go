@@ -6,21 +6,14 @@ package siv
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"testing"
 
 	"golang.org/x/sys/cpu"
 )
 
-func TestAESCMAC(t *testing.T) {
-	hasAES := cpu.X86.HasAES
-	defer func(hasAES bool) { cpu.X86.HasAES = hasAES }(hasAES)
-
-	if hasAES {
-		t.Run("Asm", testAESCMAC)
-		cpu.X86.HasAES = false
-	}
-	t.Run("Generic", testAESCMAC)
-}
+func TestAESCMAC(t *testing.T) { testBackends(t, testAESCMAC) }
 
 func testAESCMAC(t *testing.T) {
 	for i, v := range aesSivTests {
@@ -43,6 +36,46 @@ func testAESCMAC(t *testing.T) {
 	}
 }
 
+// countingBlock is a cipher.Block counting the
+// number of encrypted blocks.
+type countingBlock struct {
+	cipher.Block
+	n int
+}
+
+func (b *countingBlock) Encrypt(dst, src []byte) {
+	b.n++
+	b.Block.Encrypt(dst, src)
+}
+
+func TestCMACFromBlocks(t *testing.T) {
+	for i, v := range aesSivTests {
+		key := v.Key()
+		macBlock, _ := aes.NewCipher(key[:len(key)/2])
+		ctrBlock, _ := aes.NewCipher(key[len(key)/2:])
+		mac, ctr := &countingBlock{Block: macBlock}, &countingBlock{Block: ctrBlock}
+
+		c, err := NewCMACFromBlocks(mac, ctr)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create SIV-CMAC: %v", i, err)
+		}
+		ciphertext := c.Seal(nil, v.Nonce(), v.Plaintext(), v.AdditionalData())
+		if !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: Seal - ciphertext mismatch", i)
+		}
+		plaintext, err := c.Open(nil, v.Nonce(), ciphertext, v.AdditionalData())
+		if err != nil {
+			t.Errorf("Test %d: Open - %v", i, err)
+		}
+		if !bytes.Equal(plaintext, v.Plaintext()) {
+			t.Errorf("Test %d: Open - plaintext mismatch", i)
+		}
+		if mac.n == 0 || (len(v.Plaintext()) > 0 && ctr.n == 0) {
+			t.Errorf("Test %d: caller-supplied block ciphers not used", i)
+		}
+	}
+}
+
 func TestAESCMACAssembler(t *testing.T) {
 	if !cpu.X86.HasAES {
 		t.Skip("No assembler implementation / AES hardware support")
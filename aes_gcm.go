@@ -15,10 +15,53 @@ func NewGCM(key []byte) (cipher.AEAD, error) {
 	if k := len(key); k != 16 && k != 32 {
 		return nil, aes.KeySizeError(k)
 	}
-	return &aesGcmSiv{newGCM(key)}, nil
+	if err := checkSelfTest(); err != nil {
+		return nil, err
+	}
+	backend, err := selectBackend()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newGCM(key, backend, true)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGcmSiv{c}, nil
 }
 
-var _ cipher.AEAD = (*aesGcmSiv)(nil)
+// NewGCMSIVFromBlock returns a cipher.AEAD implementing the
+// GCM-SIV construction using an arbitrary 128 bit block cipher.
+// The newBlock function must return a block cipher for a given
+// key - like aes.NewCipher. It is called with the key-generating
+// key and with every per-message encryption key - which has the
+// same length as key. The key must be either 16 or 32 bytes long.
+//
+// If newBlock fails for a per-message encryption key, Open returns
+// the error and Seal panics.
+//
+// NewGCMSIVFromBlock always uses the generic implementation.
+// Use NewGCM for AES.
+func NewGCMSIVFromBlock(newBlock func(key []byte) (cipher.Block, error), key []byte) (cipher.AEAD, error) {
+	if k := len(key); k != 16 && k != 32 {
+		return nil, aes.KeySizeError(k)
+	}
+	if err := checkSelfTest(); err != nil {
+		return nil, err
+	}
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	if block.BlockSize() != aes.BlockSize {
+		return nil, errBlockSize
+	}
+	return &aesGcmSiv{&aesGcmSivGeneric{block: block, keyLen: len(key), newBlock: newBlock}}, nil
+}
+
+var (
+	_ cipher.AEAD = (*aesGcmSiv)(nil)
+	_ Destroyer   = (*aesGcmSiv)(nil)
+)
 
 type aesGcmSiv struct{ aead }
 
@@ -36,6 +79,9 @@ func (c *aesGcmSiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 	if uint64(len(additionalData)) > 1<<36 {
 		panic("siv: additional data too large for AES-GCM-SIV")
 	}
+	if c.aead == nil {
+		panic(ErrDestroyed)
+	}
 	ret, ciphertext := sliceForAppend(dst, len(plaintext)+c.Overhead())
 	c.seal(ciphertext, nonce, plaintext, additionalData)
 	return ret
@@ -51,6 +97,9 @@ func (c *aesGcmSiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte,
 	if uint64(len(additionalData)) > 1<<36 {
 		panic("siv: additional data too large for AES-GCM-SIV")
 	}
+	if c.aead == nil {
+		return nil, ErrDestroyed
+	}
 	if len(ciphertext) < c.Overhead() {
 		return nil, errOpen
 	}
@@ -60,3 +109,11 @@ func (c *aesGcmSiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte,
 	}
 	return ret, nil
 }
+
+// Destroy wipes all key material. See Destroyer.
+func (c *aesGcmSiv) Destroy() {
+	if c.aead != nil {
+		c.aead.destroy()
+		c.aead = nil
+	}
+}
@@ -2,28 +2,35 @@
 // Use of this source code is governed by a license that can be
 // found in the LICENSE file.
 
+//go:build amd64 && !gccgo && !appengine
 // +build amd64,!gccgo,!appengine
 
 package siv
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/subtle"
-
-	"golang.org/x/sys/cpu"
+	"runtime"
 )
 
 func polyval(tag *[16]byte, additionalData, plaintext, key []byte)
 
 func aesGcmXORKeyStream(dst, src, iv, keys []byte, keyLen uint64)
 
-func newGCM(key []byte) aead {
-	if cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ {
-		block, _ := aes.NewCipher(key)
-		return &aesGcmSivAsm{block: block, keyLen: len(key)}
+func newGCM(key []byte, backend Backend, secure bool) (aead, error) {
+	if gcmBackend(backend) == BackendAESNIPCLMUL {
+		mem, err := newKeyBuffer(4*(28+len(key)), secure)
+		if err != nil {
+			return nil, err
+		}
+		keySchedule(mem.data, key)
+		if err = mem.protect(); err != nil {
+			mem.free()
+			return nil, err
+		}
+		return &aesGcmSivAsm{block: &aesBlock{keys: mem.data, keyLen: len(key)}, keyLen: len(key), mem: mem}, nil
 	}
-	return newGCMGeneric(key)
+	return newGCMGeneric(key, secure)
 }
 
 var _ aead = (*aesGcmSivAsm)(nil)
@@ -31,11 +38,23 @@ var _ aead = (*aesGcmSivAsm)(nil)
 type aesGcmSivAsm struct {
 	block  cipher.Block
 	keyLen int
+	mem    *keyBuffer
+}
+
+func (c *aesGcmSivAsm) backend() Backend { return BackendAESNIPCLMUL }
+
+func (c *aesGcmSivAsm) destroy() {
+	c.block = nil
+	c.mem.free()
 }
 
 func (c *aesGcmSivAsm) seal(ciphertext, nonce, plaintext, additionalData []byte) {
 	encKey, authKey := deriveKeys(nonce, c.block, c.keyLen)
 
+	// The key schedule lives in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
+
 	var tag [16]byte
 	polyval(&tag, additionalData, plaintext, authKey)
 	for i := range nonce {
@@ -51,6 +70,10 @@ func (c *aesGcmSivAsm) seal(ciphertext, nonce, plaintext, additionalData []byte)
 
 	aesGcmXORKeyStream(ciphertext, plaintext, ctrBlock[:], encKeys[:], uint64(len(encKey)))
 	copy(ciphertext[len(plaintext):], tag[:])
+
+	wipe(encKeys[:])
+	wipe(encKey)
+	wipe(authKey)
 }
 
 func (c *aesGcmSivAsm) open(plaintext, nonce, ciphertext, additionalData []byte) error {
@@ -58,6 +81,11 @@ func (c *aesGcmSivAsm) open(plaintext, nonce, ciphertext, additionalData []byte)
 	ciphertext = ciphertext[:len(ciphertext)-16]
 
 	encKey, authKey := deriveKeys(nonce, c.block, c.keyLen)
+
+	// The key schedule lives in c.mem which may be unmapped by its
+	// finalizer once c is unreachable.
+	runtime.KeepAlive(c)
+
 	var ctrBlock [16]byte
 	copy(ctrBlock[:], tag)
 	ctrBlock[15] |= 0x80
@@ -74,6 +102,9 @@ func (c *aesGcmSivAsm) open(plaintext, nonce, ciphertext, additionalData []byte)
 	sum[15] &= 0x7f
 
 	encryptBlock(sum[:], sum[:], encKeys[:], uint64(len(encKey)))
+	wipe(encKeys[:])
+	wipe(encKey)
+	wipe(authKey)
 	if subtle.ConstantTimeCompare(sum[:], tag[:]) != 1 {
 		for i := range plaintext {
 			plaintext[i] = 0
@@ -64,14 +64,22 @@ aes_128_8:
 	AES_128_8(X0, X1, X2, X3, X4, X5, X6, X7, X8, AX)
 
 xor_8:
-	PXOR   (0 * 16)(SI), X0
-	PXOR   (1 * 16)(SI), X1
-	PXOR   (2 * 16)(SI), X2
-	PXOR   (3 * 16)(SI), X3
-	PXOR   (4 * 16)(SI), X4
-	PXOR   (5 * 16)(SI), X5
-	PXOR   (6 * 16)(SI), X6
-	PXOR   (7 * 16)(SI), X7
+	MOVUPS (0 * 16)(SI), X8
+	PXOR   X8, X0
+	MOVUPS (1 * 16)(SI), X8
+	PXOR   X8, X1
+	MOVUPS (2 * 16)(SI), X8
+	PXOR   X8, X2
+	MOVUPS (3 * 16)(SI), X8
+	PXOR   X8, X3
+	MOVUPS (4 * 16)(SI), X8
+	PXOR   X8, X4
+	MOVUPS (5 * 16)(SI), X8
+	PXOR   X8, X5
+	MOVUPS (6 * 16)(SI), X8
+	PXOR   X8, X6
+	MOVUPS (7 * 16)(SI), X8
+	PXOR   X8, X7
 	MOVUPS X0, (0 * 16)(DI)
 	MOVUPS X1, (1 * 16)(DI)
 	MOVUPS X2, (2 * 16)(DI)
@@ -111,10 +119,14 @@ aes_128_4:
 	AES_128_4(X0, X1, X2, X3, X4, AX)
 
 xor_4:
-	PXOR   (0 * 16)(SI), X0
-	PXOR   (1 * 16)(SI), X1
-	PXOR   (2 * 16)(SI), X2
-	PXOR   (3 * 16)(SI), X3
+	MOVUPS (0 * 16)(SI), X4
+	PXOR   X4, X0
+	MOVUPS (1 * 16)(SI), X4
+	PXOR   X4, X1
+	MOVUPS (2 * 16)(SI), X4
+	PXOR   X4, X2
+	MOVUPS (3 * 16)(SI), X4
+	PXOR   X4, X3
 	MOVUPS X0, (0 * 16)(DI)
 	MOVUPS X1, (1 * 16)(DI)
 	MOVUPS X2, (2 * 16)(DI)
@@ -143,7 +155,8 @@ aes_128_1:
 xor_1:
 	CMPQ   DX, $16
 	JB     finalize
-	PXOR   0(SI), X0
+	MOVUPS 0(SI), X1
+	PXOR   X1, X0
 	MOVUPS X0, 0(DI)
 
 	ADDQ $16, SI
@@ -170,7 +183,7 @@ return:
 	RET
 
 // func polyval(tag *[16]byte, additionalData, plaintext, key []byte)
-TEXT ·polyval(SB), $0-64
+TEXT ·polyval(SB), $0-80
 	MOVQ tag+0(FP), DI
 	MOVQ additionalData+8(FP), SI
 	MOVQ additionalData_len+16(FP), DX
@@ -212,7 +225,8 @@ finalize_loop:
 	INCQ R11
 	DECQ DX
 	JNZ  finalize_loop
-	PXOR 0(DI), X0
+	MOVOU 0(DI), X3
+	PXOR  X3, X0
 	MULTIPLY(X0, X1, X2, X3, X4, X5, X6)
 
 process_next:
@@ -223,7 +237,8 @@ process_next:
 
 	MOVQ  R14, 0(DI)
 	MOVQ  R15, 8(DI)
-	PXOR  0(DI), X0
+	MOVOU 0(DI), X3
+	PXOR  X3, X0
 	MULTIPLY(X0, X1, X2, X3, X4, X5, X6)
 	MOVOU X0, 0(DI)
 	RET
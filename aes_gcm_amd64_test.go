@@ -0,0 +1,50 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+//go:build amd64 && !gccgo && !appengine
+// +build amd64,!gccgo,!appengine
+
+package siv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/cpu"
+)
+
+// TestAESGCMCounterWrap checks that the assembler keystream
+// wraps the 32 bit block counter modulo 2^32 - as specified
+// by RFC 8452 - for all code paths processing 1, 4 and 8
+// blocks at once.
+func TestAESGCMCounterWrap(t *testing.T) {
+	if !cpu.X86.HasAES || !cpu.X86.HasPCLMULQDQ {
+		t.Skip("No assembler implementation / AES hardware support")
+	}
+	for _, key := range [][]byte{make([]byte, 16), make([]byte, 32)} {
+		block, _ := aes.NewCipher(key)
+		keys := make([]byte, 240)
+		keySchedule(keys, key)
+
+		src := make([]byte, 1024)
+		for i := range src {
+			src[i] = byte(i)
+		}
+		for _, counter := range []uint32{0xffffffff, 0xfffffffe, 0xfffffff9, 0xfffffff1, 0xffffffe0, 0xffffffc1} {
+			var iv [16]byte
+			binary.LittleEndian.PutUint32(iv[:], counter)
+			iv[15] = 0x80
+			for n := 0; n <= len(src); n++ {
+				dst, ref := make([]byte, n), make([]byte, n)
+				aesGcmXORKeyStream(dst, src[:n], iv[:], keys, uint64(len(key)))
+				xorKeystreamGeneric(ref, src[:n], block, iv[:])
+				if !bytes.Equal(dst, ref) {
+					t.Fatalf("AES-%d: counter %#x: keystream mismatch for %d bytes", 8*len(key), counter, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+)
+
+// NewExtendedGCM returns a cipher.AEAD implementing AES-GCM-SIV
+// with an extended nonce. The key must be either 16 or 32 bytes
+// long and the nonceSize must be either 24 or 32 bytes.
+//
+// The returned AEAD splits every nonce into a key-derivation part
+// N1 (the first nonceSize-12 bytes) and an AES-GCM-SIV nonce N2
+// (the last 12 bytes). It derives a per-nonce subkey from N1 using
+// the AES-GCM-SIV message-encryption-key derivation and seals the
+// plaintext with AES-GCM-SIV using the subkey and N2:
+//
+//	24 byte nonce: subkey = deriveKey(key, N1[0:12])
+//	32 byte nonce: subkey = deriveKey(deriveKey(key, N1[0:12]), N1[12:20] || 0x00000000)
+//
+// Due to the longer nonce, callers can choose nonces at random for
+// (practically) any number of messages. The ciphertext format is the
+// same as for AES-GCM-SIV. A key must be used with only one nonce
+// size and must not be used with NewGCM.
+//
+// The construction is not standardized. Ciphertexts are not
+// compatible with other extended-nonce AEADs - like XAES-256-GCM.
+func NewExtendedGCM(key []byte, nonceSize int) (cipher.AEAD, error) {
+	if k := len(key); k != 16 && k != 32 {
+		return nil, aes.KeySizeError(k)
+	}
+	if nonceSize != 24 && nonceSize != 32 {
+		return nil, errors.New("siv: invalid nonce size for extended AES-GCM-SIV")
+	}
+	if err := checkSelfTest(); err != nil {
+		return nil, err
+	}
+	backend, err := selectBackend()
+	if err != nil {
+		return nil, err
+	}
+	block, _ := newAESGeneric(key)
+	return &aesGcmSivExt{block: block, keyLen: len(key), nonceSize: nonceSize, backend: backend}, nil
+}
+
+var (
+	_ cipher.AEAD = (*aesGcmSivExt)(nil)
+	_ Destroyer   = (*aesGcmSivExt)(nil)
+)
+
+type aesGcmSivExt struct {
+	block     cipher.Block
+	keyLen    int
+	nonceSize int
+	backend   Backend
+}
+
+func (c *aesGcmSivExt) NonceSize() int { return c.nonceSize }
+
+func (c *aesGcmSivExt) Overhead() int { return aes.BlockSize }
+
+func (c *aesGcmSivExt) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.NonceSize() {
+		panic("siv: incorrect nonce length given to extended AES-GCM-SIV")
+	}
+	if c.block == nil {
+		panic(ErrDestroyed)
+	}
+	n := len(nonce) - 12
+	gcm := c.newGCM(nonce[:n])
+	defer gcm.Destroy()
+	return gcm.Seal(dst, nonce[n:], plaintext, additionalData)
+}
+
+func (c *aesGcmSivExt) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.NonceSize() {
+		panic("siv: incorrect nonce length given to extended AES-GCM-SIV")
+	}
+	if c.block == nil {
+		return nil, ErrDestroyed
+	}
+	n := len(nonce) - 12
+	gcm := c.newGCM(nonce[:n])
+	defer gcm.Destroy()
+	return gcm.Open(dst, nonce[n:], ciphertext, additionalData)
+}
+
+// Destroy wipes all key material. See Destroyer.
+func (c *aesGcmSivExt) Destroy() {
+	if c.block != nil {
+		wipeBlock(c.block)
+		c.block = nil
+	}
+}
+
+// newGCM returns the AES-GCM-SIV instance for the key-derivation
+// part of an extended nonce.
+func (c *aesGcmSivExt) newGCM(nonce []byte) *aesGcmSiv {
+	key := c.deriveKey(nonce)
+	gcm, _ := newGCM(key, c.backend, false) // Never fails without secure memory
+	wipe(key)
+	return &aesGcmSiv{gcm}
+}
+
+// deriveKey derives the per-nonce subkey from the
+// key-derivation part of an extended nonce.
+func (c *aesGcmSivExt) deriveKey(nonce []byte) []byte {
+	key, authKey := deriveKeys(nonce[:12], c.block, c.keyLen)
+	wipe(authKey)
+	if len(nonce) > 12 {
+		var n [12]byte
+		copy(n[:], nonce[12:])
+
+		block, _ := newAESGeneric(key)
+		wipe(key)
+		key, authKey = deriveKeys(n[:], block, c.keyLen)
+		wipe(authKey)
+		wipeBlock(block)
+	}
+	return key
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// aesGcmSivExtTests have been computed with an independent Python
+// implementation of the construction described by NewExtendedGCM -
+// using OpenSSL's AES and an RFC 8452 reference implementation
+// checked against Appendix C. There is no published specification
+// or third-party implementation of the extended-nonce construction.
+// Hence, interoperability with other implementations - e.g. of
+// similar designs like XAES-256-GCM - is untested.
+var aesGcmSivExtTests = []vector{
+	{
+		key:            "0100000000000000000000000000000000000000000000000000000000000000",
+		plaintext:      "0200000000000000",
+		additionalData: "01",
+		nonce:          "030405060708090a0b0c0d0e0f101112131415161718191a",
+		ciphertext:     "b2882cbb4ccdc337f7cef6a26fbbc76b538eb3b45d4443fb",
+	},
+	{
+		key:            "0100000000000000000000000000000000000000000000000000000000000000",
+		plaintext:      "0200000000000000",
+		additionalData: "01",
+		nonce:          "030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122",
+		ciphertext:     "c7b085678f4e0bf9dc8f881505acf112383128733e9dfe49",
+	},
+	{
+		key:            "01000000000000000000000000000000",
+		plaintext:      "0200000000000000",
+		additionalData: "01",
+		nonce:          "030405060708090a0b0c0d0e0f101112131415161718191a",
+		ciphertext:     "9a49a3dfefbd691f6735e6a553c4786a63171992f92c0f2b",
+	},
+	{
+		key:            "01000000000000000000000000000000",
+		plaintext:      "0200000000000000",
+		additionalData: "01",
+		nonce:          "030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122",
+		ciphertext:     "59fdf4bcd753010797f2e8d01177786c6871646212f258fc",
+	},
+	{
+		key:            "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		plaintext:      "",
+		additionalData: "",
+		nonce:          "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7",
+		ciphertext:     "c74b4ae2b122e1876759e71c6d173c05",
+	},
+	{
+		key:            "000102030405060708090a0b0c0d0e0f",
+		plaintext:      "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021",
+		additionalData: "6164646974696f6e616c2064617461",
+		nonce:          "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf",
+		ciphertext:     "4ecc713313a4c6012ec1411e349599e51fa728b4c7d5f1790c4256863c4c916fe12e8caae18bf777d1b94e3c4b1326245fff",
+	},
+}
+
+func TestExtendedGCM(t *testing.T) { testBackends(t, testExtendedGCM) }
+
+func testExtendedGCM(t *testing.T) {
+	for i, v := range aesGcmSivExtTests {
+		c, err := NewExtendedGCM(v.Key(), len(v.Nonce()))
+		if err != nil {
+			t.Errorf("Test %d: Failed to create extended AES-GCM-SIV: %v", i, err)
+			continue
+		}
+		ciphertext := c.Seal(nil, v.Nonce(), v.Plaintext(), v.AdditionalData())
+		if !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: Seal - ciphertext mismatch: %s - %s", i, v.ciphertext, hex.EncodeToString(ciphertext))
+		}
+		plaintext, err := c.Open(ciphertext[:0], v.Nonce(), ciphertext, v.AdditionalData())
+		if err != nil {
+			t.Errorf("Test %d: Open failed - %v", i, err)
+		}
+		if !bytes.Equal(plaintext, v.Plaintext()) {
+			t.Errorf("Test %d: Open - plaintext mismatch", i)
+		}
+	}
+}
+
+// TestExtendedGCMSubkey checks that the extended AES-GCM-SIV is
+// AES-GCM-SIV keyed with the subkey derived as specified by
+// NewExtendedGCM. The subkeys are derived independently of the
+// package's key derivation, as described in RFC 8452 Section 4,
+// and NewGCM itself is checked against the RFC 8452 vectors.
+func TestExtendedGCMSubkey(t *testing.T) {
+	deriveKey := func(key, nonce []byte) []byte {
+		block, _ := aes.NewCipher(key)
+		var in, out [16]byte
+		copy(in[4:], nonce)
+		var subkey []byte
+		for i := uint32(2); len(subkey) < len(key); i++ {
+			binary.LittleEndian.PutUint32(in[:4], i)
+			block.Encrypt(out[:], in[:])
+			subkey = append(subkey, out[:8]...)
+		}
+		return subkey
+	}
+
+	for i, v := range aesGcmSivExtTests {
+		nonce := v.Nonce()
+		n := len(nonce) - 12
+		subkey := deriveKey(v.Key(), nonce[:12])
+		if n > 12 {
+			subkey = deriveKey(subkey, nonce[12:n])
+		}
+		c, err := NewGCM(subkey)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create AES-GCM-SIV: %v", i, err)
+		}
+		ciphertext := c.Seal(nil, nonce[n:], v.Plaintext(), v.AdditionalData())
+		if !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: ciphertext mismatch: %s - %s", i, v.ciphertext, hex.EncodeToString(ciphertext))
+		}
+	}
+}
@@ -9,23 +9,38 @@ import (
 	"crypto/cipher"
 	"crypto/subtle"
 	"encoding/binary"
+	"runtime"
 )
 
-func newGCMGeneric(key []byte) aead {
-	block, _ := aes.NewCipher(key)
-	return &aesGcmSivGeneric{block: block, keyLen: len(key)}
+func newGCMGeneric(key []byte, secure bool) (aead, error) {
+	mem, err := newKeyBuffer(4*(28+len(key)), secure)
+	if err != nil {
+		return nil, err
+	}
+	expandKeyGeneric(mem.data, key)
+	if err = mem.protect(); err != nil {
+		mem.free()
+		return nil, err
+	}
+	return &aesGcmSivGeneric{block: &aesGeneric{keys: mem.data}, keyLen: len(key), newBlock: newAESGeneric, mem: mem}, nil
 }
 
 var _ aead = (*aesGcmSivGeneric)(nil)
 
 type aesGcmSivGeneric struct {
-	block  cipher.Block
-	keyLen int
+	block    cipher.Block
+	keyLen   int
+	newBlock func(key []byte) (cipher.Block, error)
+	mem      *keyBuffer // The key schedule of block or nil if block is provided by the caller
 }
 
 func (c *aesGcmSivGeneric) seal(ciphertext, nonce, plaintext, additionalData []byte) {
 	encKey, authKey := deriveKeys(nonce, c.block, c.keyLen)
 
+	// The key schedule may live in c.mem which may be unmapped by
+	// its finalizer once c is unreachable.
+	runtime.KeepAlive(c)
+
 	var tag [16]byte
 	polyvalGeneric(&tag, additionalData, plaintext, authKey)
 	for i := range nonce {
@@ -33,13 +48,22 @@ func (c *aesGcmSivGeneric) seal(ciphertext, nonce, plaintext, additionalData []b
 	}
 	tag[15] &= 0x7f
 
-	block, _ := aes.NewCipher(encKey)
+	block, err := c.encryptionBlock(encKey)
+	if err != nil {
+		wipe(encKey)
+		wipe(authKey)
+		panic("siv: failed to create block cipher for message-encryption key: " + err.Error())
+	}
 	block.Encrypt(tag[:], tag[:])
 	ctrBlock := tag
 	ctrBlock[15] |= 0x80
 
-	xorKeystreamGeneric(ciphertext, plaintext, encKey, ctrBlock[:])
+	xorKeystreamGeneric(ciphertext, plaintext, block, ctrBlock[:])
 	copy(ciphertext[len(plaintext):], tag[:])
+
+	wipeBlock(block)
+	wipe(encKey)
+	wipe(authKey)
 }
 
 func (c *aesGcmSivGeneric) open(plaintext, nonce, ciphertext, additionalData []byte) error {
@@ -47,10 +71,20 @@ func (c *aesGcmSivGeneric) open(plaintext, nonce, ciphertext, additionalData []b
 	ciphertext = ciphertext[:len(ciphertext)-16]
 
 	encKey, authKey := deriveKeys(nonce, c.block, c.keyLen)
+
+	// The key schedule may live in c.mem which may be unmapped by
+	// its finalizer once c is unreachable.
+	runtime.KeepAlive(c)
 	var ctrBlock [16]byte
 	copy(ctrBlock[:], tag)
 	ctrBlock[15] |= 0x80
-	xorKeystreamGeneric(plaintext, ciphertext, encKey, ctrBlock[:])
+	block, err := c.encryptionBlock(encKey)
+	if err != nil {
+		wipe(encKey)
+		wipe(authKey)
+		return err
+	}
+	xorKeystreamGeneric(plaintext, ciphertext, block, ctrBlock[:])
 
 	var sum [16]byte
 	polyvalGeneric(&sum, additionalData, plaintext, authKey)
@@ -59,8 +93,10 @@ func (c *aesGcmSivGeneric) open(plaintext, nonce, ciphertext, additionalData []b
 	}
 	sum[15] &= 0x7f
 
-	block, _ := aes.NewCipher(encKey)
 	block.Encrypt(sum[:], sum[:])
+	wipeBlock(block)
+	wipe(encKey)
+	wipe(authKey)
 	if subtle.ConstantTimeCompare(sum[:], tag[:]) != 1 {
 		for i := range plaintext {
 			plaintext[i] = 0
@@ -70,6 +106,29 @@ func (c *aesGcmSivGeneric) open(plaintext, nonce, ciphertext, additionalData []b
 	return nil
 }
 
+func (c *aesGcmSivGeneric) backend() Backend { return BackendGeneric }
+
+func (c *aesGcmSivGeneric) destroy() {
+	wipeBlock(c.block)
+	c.block = nil
+	if c.mem != nil {
+		c.mem.free()
+	}
+}
+
+// encryptionBlock returns the block cipher for the
+// message-encryption key.
+func (c *aesGcmSivGeneric) encryptionBlock(encKey []byte) (cipher.Block, error) {
+	block, err := c.newBlock(encKey)
+	if err != nil {
+		return nil, err
+	}
+	if block.BlockSize() != aes.BlockSize {
+		return nil, errBlockSize
+	}
+	return block, nil
+}
+
 func deriveKeys(nonce []byte, block cipher.Block, keyLen int) (encKey, authKey []byte) {
 	var counter [16]byte
 	encKey = make([]byte, 32)
@@ -94,6 +153,7 @@ func deriveKeys(nonce []byte, block cipher.Block, keyLen int) (encKey, authKey [
 	copy(encKey[8:], tmp[:8])
 
 	if keyLen == 16 {
+		wipe(tmp[:])
 		return encKey[:16], authKey
 	}
 
@@ -105,14 +165,14 @@ func deriveKeys(nonce []byte, block cipher.Block, keyLen int) (encKey, authKey [
 	block.Encrypt(tmp[:], counter[:])
 	copy(encKey[24:], tmp[:8])
 
+	wipe(tmp[:])
 	return encKey, authKey
 }
 
-func xorKeystreamGeneric(dst, src, key, iv []byte) {
+func xorKeystreamGeneric(dst, src []byte, block cipher.Block, iv []byte) {
 	var ctr, tmp [16]byte
 	copy(ctr[:], iv)
 	counter := binary.LittleEndian.Uint32(ctr[:])
-	block, _ := aes.NewCipher(key)
 	for len(src) >= 16 {
 		block.Encrypt(tmp[:], ctr[:])
 		for i := range tmp {
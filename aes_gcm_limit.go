@@ -0,0 +1,210 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"errors"
+	"sync"
+)
+
+// ErrKeyExhausted is returned by a LimitedAEAD when a key
+// has reached its hard usage limit and no fresh key is
+// available.
+var ErrKeyExhausted = errors.New("siv: key usage limit exceeded")
+
+// Default usage limits for AES-GCM-SIV keys. They are conservative
+// w.r.t. the per-key bounds discussed in RFC 8452 Section 9: A
+// key should not be used for more than 2^48 messages with random
+// nonces and not for more than 2^50 bytes of plaintext.
+const (
+	DefaultGCMMessageLimit = 1 << 48
+	DefaultGCMByteLimit    = 1 << 50
+)
+
+// DefaultRetiredKeys is the default number of previous
+// keys a LimitedAEAD keeps to open older ciphertexts.
+const DefaultRetiredKeys = 16
+
+// UsageLimit configures the usage accounting of a LimitedAEAD.
+//
+// The soft limits default to 3/4 of the corresponding hard limit
+// and the hard limits default to DefaultGCMMessageLimit and
+// DefaultGCMByteLimit. RetiredKeys defaults to DefaultRetiredKeys.
+type UsageLimit struct {
+	SoftMessages, HardMessages uint64
+	SoftBytes, HardBytes       uint64
+
+	// RetiredKeys is the maximum number of previous keys kept
+	// for Open. The oldest key is dropped once a key rotation
+	// exceeds this limit.
+	RetiredKeys int
+
+	// OnSoftLimit, if not nil, is called once per key when the
+	// key reaches one of its soft limits. It is called by Seal
+	// without holding the lock of the LimitedAEAD and may call
+	// its methods.
+	OnSoftLimit func()
+
+	// NewKey, if not nil, is called to obtain a fresh key once
+	// the current key reaches one of its hard limits. It is
+	// called by Seal while holding the lock of the LimitedAEAD.
+	// Therefore, it must not call any method of the LimitedAEAD
+	// and concurrent Seal and Open calls block until it returns.
+	NewKey func() ([]byte, error)
+}
+
+// LimitedAEAD is an AES-GCM-SIV AEAD that counts the messages
+// and bytes sealed under its key. Once the key reaches its hard
+// limit the LimitedAEAD switches to a fresh key - if a key
+// provider is configured - or refuses to seal any further
+// messages.
+//
+// A LimitedAEAD keeps up to UsageLimit.RetiredKeys previous keys
+// such that Open can decrypt ciphertexts produced before a key
+// rotation. It is safe for concurrent use by multiple goroutines.
+type LimitedAEAD struct {
+	limit UsageLimit
+
+	mu       sync.Mutex
+	current  cipher.AEAD
+	messages uint64
+	bytes    uint64
+	notified bool
+	retired  []cipher.AEAD
+}
+
+// NewLimitedGCM returns a LimitedAEAD implementing AES-GCM-SIV
+// using the given key and usage limit. The key must be either
+// 16 or 32 bytes long.
+func NewLimitedGCM(key []byte, limit UsageLimit) (*LimitedAEAD, error) {
+	if limit.HardMessages == 0 {
+		limit.HardMessages = DefaultGCMMessageLimit
+	}
+	if limit.HardBytes == 0 {
+		limit.HardBytes = DefaultGCMByteLimit
+	}
+	if limit.SoftMessages == 0 || limit.SoftMessages > limit.HardMessages {
+		limit.SoftMessages = limit.HardMessages - limit.HardMessages/4
+	}
+	if limit.SoftBytes == 0 || limit.SoftBytes > limit.HardBytes {
+		limit.SoftBytes = limit.HardBytes - limit.HardBytes/4
+	}
+	if limit.RetiredKeys <= 0 {
+		limit.RetiredKeys = DefaultRetiredKeys
+	}
+
+	c, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LimitedAEAD{limit: limit, current: c}, nil
+}
+
+// NonceSize returns the size of the nonce that must be passed
+// to Seal and Open.
+func (c *LimitedAEAD) NonceSize() int { return 12 }
+
+// Overhead returns the maximum difference between the lengths
+// of a plaintext and its ciphertext.
+func (c *LimitedAEAD) Overhead() int { return 16 }
+
+// Usage returns the number of messages and bytes sealed under
+// the current key.
+func (c *LimitedAEAD) Usage() (messages, bytes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages, c.bytes
+}
+
+// Seal encrypts and authenticates plaintext like cipher.AEAD.Seal.
+// It returns ErrKeyExhausted if sealing the plaintext would exceed
+// the hard limit of the current key and no fresh key is available.
+func (c *LimitedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	aead, notify, err := c.reserve(uint64(len(plaintext)))
+	if err != nil {
+		return nil, err
+	}
+	if notify && c.limit.OnSoftLimit != nil {
+		c.limit.OnSoftLimit()
+	}
+	return aead.Seal(dst, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts and authenticates ciphertext like cipher.AEAD.Open.
+// It tries the current key first and then all retained previous
+// keys - newest first.
+func (c *LimitedAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	c.mu.Lock()
+	current, retired := c.current, c.retired
+	c.mu.Unlock()
+
+	if len(retired) == 0 {
+		return current.Open(dst, nonce, ciphertext, additionalData)
+	}
+
+	// A failed Open may overwrite dst - which may alias the
+	// ciphertext. Therefore, decrypt into a scratch buffer and
+	// only copy the plaintext of a successful Open to dst.
+	plaintext, err := current.Open(nil, nonce, ciphertext, additionalData)
+	for i := len(retired) - 1; err != nil && i >= 0; i-- {
+		plaintext, err = retired[i].Open(plaintext[:0], nonce, ciphertext, additionalData)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret, out := sliceForAppend(dst, len(plaintext))
+	copy(out, plaintext)
+	wipe(plaintext)
+	return ret, nil
+}
+
+// reserve accounts one message of n bytes to the current key and
+// returns the AEAD that must be used to seal it. It rotates the key
+// if the hard limit would be exceeded.
+func (c *LimitedAEAD) reserve(n uint64) (aead cipher.AEAD, notify bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n > c.limit.HardBytes {
+		return nil, false, ErrKeyExhausted
+	}
+	if c.messages+1 > c.limit.HardMessages || n > c.limit.HardBytes-c.bytes {
+		if err = c.rotate(); err != nil {
+			return nil, false, err
+		}
+	}
+	c.messages++
+	c.bytes += n
+	if !c.notified && (c.messages >= c.limit.SoftMessages || c.bytes >= c.limit.SoftBytes) {
+		c.notified = true
+		notify = true
+	}
+	return c.current, notify, nil
+}
+
+func (c *LimitedAEAD) rotate() error {
+	if c.limit.NewKey == nil {
+		return ErrKeyExhausted
+	}
+	key, err := c.limit.NewKey()
+	if err != nil {
+		return err
+	}
+	aead, err := NewGCM(key)
+	if err != nil {
+		return err
+	}
+	// Open may still use a snapshot of c.retired. Therefore,
+	// the oldest key is dropped by re-slicing and existing
+	// elements are never modified.
+	c.retired = append(c.retired, c.current)
+	if n := len(c.retired); n > c.limit.RetiredKeys {
+		c.retired = c.retired[n-c.limit.RetiredKeys:]
+	}
+	c.current = aead
+	c.messages, c.bytes, c.notified = 0, 0, false
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLimitedGCM(t *testing.T) {
+	var softLimits int
+	c, err := NewLimitedGCM(make([]byte, 32), UsageLimit{
+		SoftMessages: 2,
+		HardMessages: 3,
+		OnSoftLimit:  func() { softLimits++ },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limited AES-GCM-SIV: %v", err)
+	}
+
+	nonce, plaintext := make([]byte, c.NonceSize()), []byte("plaintext")
+	for i := 0; i < 3; i++ {
+		if _, err = c.Seal(nil, nonce, plaintext, nil); err != nil {
+			t.Fatalf("Test %d: Seal failed: %v", i, err)
+		}
+	}
+	if softLimits != 1 {
+		t.Fatalf("Soft limit callback called %d times - want 1", softLimits)
+	}
+	if messages, bytes := c.Usage(); messages != 3 || bytes != 3*uint64(len(plaintext)) {
+		t.Fatalf("Usage mismatch: got %d messages and %d bytes", messages, bytes)
+	}
+	if _, err = c.Seal(nil, nonce, plaintext, nil); err != ErrKeyExhausted {
+		t.Fatalf("Expected ErrKeyExhausted - got: %v", err)
+	}
+}
+
+func TestLimitedGCMRotate(t *testing.T) {
+	var keys int
+	c, err := NewLimitedGCM(make([]byte, 16), UsageLimit{
+		HardBytes: 64,
+		NewKey: func() ([]byte, error) {
+			keys++
+			key := make([]byte, 16)
+			key[0] = byte(keys)
+			return key, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limited AES-GCM-SIV: %v", err)
+	}
+
+	nonce, plaintext := make([]byte, c.NonceSize()), make([]byte, 48)
+	first, err := c.Seal(nil, nonce, plaintext, nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	second, err := c.Seal(nil, nonce, plaintext, nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if keys != 1 {
+		t.Fatalf("Key provider called %d times - want 1", keys)
+	}
+	if bytes.Equal(first, second) {
+		t.Fatal("Key has not been rotated")
+	}
+	for i, ciphertext := range [][]byte{first, second} {
+		if p, err := c.Open(nil, nonce, ciphertext, nil); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("Test %d: Open failed: %v", i, err)
+		}
+	}
+	if _, err = c.Seal(nil, nonce, make([]byte, 65), nil); err != ErrKeyExhausted {
+		t.Fatalf("Expected ErrKeyExhausted - got: %v", err)
+	}
+}
+
+func TestLimitedGCMRetiredKeys(t *testing.T) {
+	var keys int
+	c, err := NewLimitedGCM(make([]byte, 16), UsageLimit{
+		HardMessages: 1,
+		RetiredKeys:  2,
+		NewKey: func() ([]byte, error) {
+			keys++
+			key := make([]byte, 16)
+			key[0] = byte(keys)
+			return key, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limited AES-GCM-SIV: %v", err)
+	}
+
+	nonce, plaintext := make([]byte, c.NonceSize()), []byte("plaintext")
+	var ciphertexts [][]byte
+	for i := 0; i < 4; i++ {
+		ciphertext, err := c.Seal(nil, nonce, plaintext, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Seal failed: %v", i, err)
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	if _, err = c.Open(nil, nonce, ciphertexts[0], nil); err == nil {
+		t.Fatal("Open succeeded with a dropped key")
+	}
+	for i, ciphertext := range ciphertexts[1:] {
+		if p, err := c.Open(nil, nonce, ciphertext, nil); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("Test %d: Open failed: %v", i, err)
+		}
+		// Opening in-place must not destroy the ciphertext
+		// before the retired keys have been tried.
+		if p, err := c.Open(ciphertext[:0], nonce, ciphertext, nil); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("Test %d: in-place Open failed: %v", i, err)
+		}
+	}
+}
+
+func TestLimitedGCMSoftLimitCallback(t *testing.T) {
+	var c *LimitedAEAD
+	var messages uint64
+	c, err := NewLimitedGCM(make([]byte, 16), UsageLimit{
+		SoftMessages: 1,
+		HardMessages: 2,
+		OnSoftLimit:  func() { messages, _ = c.Usage() },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limited AES-GCM-SIV: %v", err)
+	}
+	if _, err = c.Seal(nil, make([]byte, c.NonceSize()), nil, nil); err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if messages != 1 {
+		t.Fatalf("OnSoftLimit: got %d messages - want 1", messages)
+	}
+}
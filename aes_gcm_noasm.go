@@ -2,8 +2,11 @@
 // Use of this source code is governed by a license that can be
 // found in the LICENSE file.
 
+//go:build !amd64 || gccgo || appengine
 // +build !amd64 gccgo appengine
 
 package siv
 
-func newGCM(key []byte) aead { return newGCMGeneric(key) }
+func newGCM(key []byte, backend Backend, secure bool) (aead, error) {
+	return newGCMGeneric(key, secure)
+}
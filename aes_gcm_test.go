@@ -5,22 +5,16 @@ package siv
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"golang.org/x/sys/cpu"
 )
 
-func TestAESGCM(t *testing.T) {
-	hasAES, hashGHASH := cpu.X86.HasAES, cpu.X86.HasPCLMULQDQ
-	defer func(hasAES, hashGHASH bool) { cpu.X86.HasAES, cpu.X86.HasPCLMULQDQ = hasAES, hashGHASH }(hasAES, hashGHASH)
-
-	if hasAES && hashGHASH {
-		t.Run("Asm", testAESGCM)
-		cpu.X86.HasAES, cpu.X86.HasPCLMULQDQ = false, false
-	}
-	t.Run("Generic", testAESGCM)
-}
+func TestAESGCM(t *testing.T) { testBackends(t, testAESGCM) }
 
 func testAESGCM(t *testing.T) {
 	for i, v := range aesGcmSivTests {
@@ -43,6 +37,68 @@ func testAESGCM(t *testing.T) {
 	}
 }
 
+func TestGCMSIVFromBlock(t *testing.T) {
+	for i, v := range aesGcmSivTests {
+		var blocks []*countingBlock
+		newBlock := func(key []byte) (cipher.Block, error) {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, &countingBlock{Block: block})
+			return blocks[len(blocks)-1], nil
+		}
+
+		c, err := NewGCMSIVFromBlock(newBlock, v.Key())
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create GCM-SIV: %v", i, err)
+		}
+		ciphertext := c.Seal(nil, v.Nonce(), v.Plaintext(), v.AdditionalData())
+		if !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: Seal - ciphertext mismatch: %s - %s", i, v.ciphertext, hex.EncodeToString(ciphertext))
+		}
+		plaintext, err := c.Open(nil, v.Nonce(), ciphertext, v.AdditionalData())
+		if err != nil {
+			t.Errorf("Test %d: Open failed - %v", i, err)
+		}
+		if !bytes.Equal(plaintext, v.Plaintext()) {
+			t.Errorf("Test %d: Open - plaintext mismatch", i)
+		}
+		for j, b := range blocks {
+			if b.n == 0 {
+				t.Errorf("Test %d: caller-supplied block cipher %d not used", i, j)
+			}
+		}
+	}
+}
+
+func TestGCMSIVFromBlockError(t *testing.T) {
+	errNewBlock := errors.New("newBlock failed")
+	var calls int
+	newBlock := func(key []byte) (cipher.Block, error) {
+		if calls++; calls > 2 {
+			return nil, errNewBlock
+		}
+		return aes.NewCipher(key)
+	}
+	c, err := NewGCMSIVFromBlock(newBlock, make([]byte, 16))
+	if err != nil {
+		t.Fatalf("Failed to create GCM-SIV: %v", err)
+	}
+	nonce := make([]byte, c.NonceSize())
+	ciphertext := c.Seal(nil, nonce, []byte("plaintext"), nil)
+	if _, err = c.Open(nil, nonce, ciphertext, nil); err != errNewBlock {
+		t.Fatalf("Open: got error %v - want %v", err, errNewBlock)
+	}
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatal("Seal did not panic")
+		}
+	}()
+	c.Seal(nil, nonce, []byte("plaintext"), nil)
+}
+
 func TestAESGCMAssembler(t *testing.T) {
 	if !cpu.X86.HasAES || !cpu.X86.HasPCLMULQDQ {
 		t.Skip("No assembler implementation / AES hardware support")
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// The generic backend uses its own AES implementation instead of
+// aes.NewCipher since the standard library keeps the key schedule
+// in memory that cannot be wiped. The implementation only supports
+// encryption and - like the generic AES implementation of the
+// standard library - uses lookup tables. Therefore, it is not
+// constant-time.
+
+var (
+	sbox               [256]byte
+	te0, te1, te2, te3 [256]uint32
+	rcon               [10]byte
+)
+
+func init() {
+	// Compute the S-box by iterating over the multiplicative
+	// group of GF(2^8) with the generator 3 (p) and its inverse (q).
+	p, q := byte(1), byte(1)
+	for {
+		p = p ^ p<<1 ^ byte(int8(p)>>7)&0x1b
+		q ^= q << 1
+		q ^= q << 2
+		q ^= q << 4
+		q ^= byte(int8(q)>>7) & 0x09
+
+		x := q ^ rotl8(q, 1) ^ rotl8(q, 2) ^ rotl8(q, 3) ^ rotl8(q, 4)
+		sbox[p] = x ^ 0x63
+		if p == 1 {
+			break
+		}
+	}
+	sbox[0] = 0x63
+
+	for i, s := range sbox {
+		s2 := xtime(s)
+		w := uint32(s2)<<24 | uint32(s)<<16 | uint32(s)<<8 | uint32(s2^s)
+		te0[i] = w
+		te1[i] = w>>8 | w<<24
+		te2[i] = w>>16 | w<<16
+		te3[i] = w>>24 | w<<8
+	}
+
+	r := byte(1)
+	for i := range rcon {
+		rcon[i] = r
+		r = xtime(r)
+	}
+}
+
+func rotl8(x byte, n uint) byte { return x<<n | x>>(8-n) }
+
+// xtime multiplies x by 2 in GF(2^8).
+func xtime(x byte) byte { return x<<1 ^ byte(int8(x)>>7)&0x1b }
+
+func subWord(w uint32) uint32 {
+	return uint32(sbox[w>>24])<<24 | uint32(sbox[w>>16&0xff])<<16 | uint32(sbox[w>>8&0xff])<<8 | uint32(sbox[w&0xff])
+}
+
+// expandKeyGeneric computes the AES key schedule of key and writes
+// it to keys - which must be 4 * (28 + len(key)) bytes long.
+func expandKeyGeneric(keys, key []byte) {
+	nk := len(key) / 4
+	n := len(keys) / 4
+	var w, prev uint32
+	for i := 0; i < n; i++ {
+		if i < nk {
+			w = binary.BigEndian.Uint32(key[4*i:])
+		} else {
+			t := prev
+			if i%nk == 0 {
+				t = subWord(t<<8|t>>24) ^ uint32(rcon[i/nk-1])<<24
+			} else if nk > 6 && i%nk == 4 {
+				t = subWord(t)
+			}
+			w = binary.BigEndian.Uint32(keys[4*(i-nk):]) ^ t
+		}
+		binary.BigEndian.PutUint32(keys[4*i:], w)
+		prev = w
+	}
+}
+
+// aesGeneric is a cipher.Block using the key schedule computed
+// by expandKeyGeneric. It only supports encryption. The key
+// schedule is owned - and wiped - by the caller.
+type aesGeneric struct {
+	keys []byte
+}
+
+func (b *aesGeneric) BlockSize() int { return aes.BlockSize }
+
+func (b *aesGeneric) Encrypt(dst, src []byte) {
+	if len(src) < aes.BlockSize || len(dst) < aes.BlockSize {
+		panic("siv: input not full block")
+	}
+	xk := b.keys
+	s0 := binary.BigEndian.Uint32(src[0:]) ^ binary.BigEndian.Uint32(xk[0:])
+	s1 := binary.BigEndian.Uint32(src[4:]) ^ binary.BigEndian.Uint32(xk[4:])
+	s2 := binary.BigEndian.Uint32(src[8:]) ^ binary.BigEndian.Uint32(xk[8:])
+	s3 := binary.BigEndian.Uint32(src[12:]) ^ binary.BigEndian.Uint32(xk[12:])
+
+	var t0, t1, t2, t3 uint32
+	for xk = xk[16:]; len(xk) > 16; xk = xk[16:] {
+		t0 = binary.BigEndian.Uint32(xk[0:]) ^ te0[s0>>24] ^ te1[s1>>16&0xff] ^ te2[s2>>8&0xff] ^ te3[s3&0xff]
+		t1 = binary.BigEndian.Uint32(xk[4:]) ^ te0[s1>>24] ^ te1[s2>>16&0xff] ^ te2[s3>>8&0xff] ^ te3[s0&0xff]
+		t2 = binary.BigEndian.Uint32(xk[8:]) ^ te0[s2>>24] ^ te1[s3>>16&0xff] ^ te2[s0>>8&0xff] ^ te3[s1&0xff]
+		t3 = binary.BigEndian.Uint32(xk[12:]) ^ te0[s3>>24] ^ te1[s0>>16&0xff] ^ te2[s1>>8&0xff] ^ te3[s2&0xff]
+		s0, s1, s2, s3 = t0, t1, t2, t3
+	}
+
+	// The last round omits MixColumns.
+	t0 = uint32(sbox[s0>>24])<<24 | uint32(sbox[s1>>16&0xff])<<16 | uint32(sbox[s2>>8&0xff])<<8 | uint32(sbox[s3&0xff])
+	t1 = uint32(sbox[s1>>24])<<24 | uint32(sbox[s2>>16&0xff])<<16 | uint32(sbox[s3>>8&0xff])<<8 | uint32(sbox[s0&0xff])
+	t2 = uint32(sbox[s2>>24])<<24 | uint32(sbox[s3>>16&0xff])<<16 | uint32(sbox[s0>>8&0xff])<<8 | uint32(sbox[s1&0xff])
+	t3 = uint32(sbox[s3>>24])<<24 | uint32(sbox[s0>>16&0xff])<<16 | uint32(sbox[s1>>8&0xff])<<8 | uint32(sbox[s2&0xff])
+
+	binary.BigEndian.PutUint32(dst[0:], t0^binary.BigEndian.Uint32(xk[0:]))
+	binary.BigEndian.PutUint32(dst[4:], t1^binary.BigEndian.Uint32(xk[4:]))
+	binary.BigEndian.PutUint32(dst[8:], t2^binary.BigEndian.Uint32(xk[8:]))
+	binary.BigEndian.PutUint32(dst[12:], t3^binary.BigEndian.Uint32(xk[12:]))
+}
+
+func (b *aesGeneric) Decrypt(dst, src []byte) { panic("siv: AES decryption is not supported") }
+
+// aesGenericOwned is an aesGeneric that owns its key
+// schedule. Destroy wipes the key schedule.
+type aesGenericOwned struct{ aesGeneric }
+
+// newAESGeneric returns an AES block cipher for the key. In
+// contrast to aes.NewCipher, the returned block cipher
+// implements Destroyer. It only supports encryption.
+func newAESGeneric(key []byte) (cipher.Block, error) {
+	if k := len(key); k != 16 && k != 24 && k != 32 {
+		return nil, aes.KeySizeError(k)
+	}
+	b := &aesGenericOwned{aesGeneric{keys: make([]byte, 4*(28+len(key)))}}
+	expandKeyGeneric(b.keys, key)
+	return b, nil
+}
+
+func (b *aesGenericOwned) Destroy() { wipe(b.keys) }
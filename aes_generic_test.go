@@ -0,0 +1,73 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// FIPS 197, Appendix C
+var aesGenericTests = []struct {
+	key, plaintext, ciphertext string
+}{
+	{
+		key:        "000102030405060708090a0b0c0d0e0f",
+		plaintext:  "00112233445566778899aabbccddeeff",
+		ciphertext: "69c4e0d86a7b0430d8cdb78070b4c55a",
+	},
+	{
+		key:        "000102030405060708090a0b0c0d0e0f1011121314151617",
+		plaintext:  "00112233445566778899aabbccddeeff",
+		ciphertext: "dda97ca4864cdfe06eaf70a0ec0d7191",
+	},
+	{
+		key:        "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		plaintext:  "00112233445566778899aabbccddeeff",
+		ciphertext: "8ea2b7ca516745bfeafc49904b496089",
+	},
+}
+
+func TestAESGeneric(t *testing.T) {
+	for i, test := range aesGenericTests {
+		block, err := newAESGeneric(mustDecode(test.key))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create AES: %v", i, err)
+		}
+		ciphertext := make([]byte, aes.BlockSize)
+		block.Encrypt(ciphertext, mustDecode(test.plaintext))
+		if !bytes.Equal(ciphertext, mustDecode(test.ciphertext)) {
+			t.Errorf("Test %d: ciphertext mismatch: got %s - want %s", i, hex.EncodeToString(ciphertext), test.ciphertext)
+		}
+
+		keys := block.(*aesGenericOwned).keys
+		block.(Destroyer).Destroy()
+		if !bytes.Equal(keys, make([]byte, len(keys))) {
+			t.Errorf("Test %d: key schedule has not been wiped", i)
+		}
+	}
+}
+
+func TestAESGenericStdlib(t *testing.T) {
+	src := make([]byte, aes.BlockSize)
+	for _, keySize := range []int{16, 24, 32} {
+		key := make([]byte, keySize)
+		for i := 0; i < 256; i++ {
+			key[i%keySize] ^= byte(i)
+			block, _ := newAESGeneric(key)
+			ref, _ := aes.NewCipher(key)
+
+			dst, refDst := make([]byte, aes.BlockSize), make([]byte, aes.BlockSize)
+			block.Encrypt(dst, src)
+			ref.Encrypt(refDst, src)
+			if !bytes.Equal(dst, refDst) {
+				t.Fatalf("Key size %d: Test %d: ciphertext mismatch", keySize, i)
+			}
+			copy(src, dst)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+//go:build !amd64 || gccgo || appengine
+// +build !amd64 gccgo appengine
+
+package siv
+
+// cpuBackend returns the fastest backend supported by the CPU.
+func cpuBackend() Backend { return BackendGeneric }
@@ -0,0 +1,168 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Backend identifies an implementation of AES-SIV-CMAC or
+// AES-GCM-SIV.
+type Backend string
+
+// The backends ordered by the CPU features they require.
+// AES-SIV-CMAC uses either the generic or the AES-NI backend.
+// AES-GCM-SIV uses either the generic or the AES-NI+PCLMUL
+// backend.
+const (
+	BackendGeneric     Backend = "generic"      // Pure Go
+	BackendAESNI       Backend = "aesni"        // AES-NI instructions
+	BackendAESNIPCLMUL Backend = "aesni+pclmul" // AES-NI and PCLMULQDQ instructions
+)
+
+const (
+	backendEnvVar       = "SIVDEBUG"
+	backendEnvVarOption = "backend="
+)
+
+func (b Backend) rank() int {
+	switch b {
+	case BackendGeneric:
+		return 0
+	case BackendAESNI:
+		return 1
+	case BackendAESNIPCLMUL:
+		return 2
+	default:
+		return -1
+	}
+}
+
+var (
+	errUnknownBackend     = errors.New("siv: unknown backend")
+	errBackendUnsupported = errors.New("siv: backend not supported by the CPU")
+)
+
+var (
+	backendLock   sync.RWMutex
+	backendForced Backend
+	backendErr    error
+)
+
+func init() {
+	if err := setBackendDebug(os.Getenv(backendEnvVar)); err != nil {
+		backendErr = err
+	}
+}
+
+// setBackendDebug sets the backend specified by the
+// comma-separated list of key=value options.
+func setBackendDebug(options string) error {
+	for _, option := range strings.Split(options, ",") {
+		if strings.HasPrefix(option, backendEnvVarOption) {
+			return SetBackend(Backend(strings.TrimPrefix(option, backendEnvVarOption)))
+		}
+	}
+	return nil
+}
+
+// Backends returns all backends supported by the CPU - starting
+// with the generic backend.
+func Backends() []Backend {
+	backends := []Backend{BackendGeneric, BackendAESNI, BackendAESNIPCLMUL}
+	return backends[:cpuBackend().rank()+1]
+}
+
+// SetBackend limits the backends used by AEADs created afterwards
+// to b and all backends requiring fewer CPU features - e.g.
+// BackendAESNI selects the AES-NI backend for AES-SIV-CMAC and the
+// generic backend for AES-GCM-SIV. An empty Backend removes the
+// limit such that the fastest backend supported by the CPU is used.
+//
+// SetBackend returns an error if b is not supported by the CPU.
+// The backend can also be set with the environment variable
+// SIVDEBUG - e.g. SIVDEBUG=backend=generic. If the backend set by
+// SIVDEBUG is invalid, NewCMAC, NewGCM and NewExtendedGCM fail
+// until SetBackend is called.
+func SetBackend(b Backend) error {
+	if b != "" {
+		if b.rank() < 0 {
+			return errUnknownBackend
+		}
+		if b.rank() > cpuBackend().rank() {
+			return errBackendUnsupported
+		}
+	}
+
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backendForced, backendErr = b, nil
+	return nil
+}
+
+// selectBackend returns the fastest backend supported by the CPU
+// and allowed by SetBackend.
+func selectBackend() (Backend, error) {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+
+	if backendErr != nil {
+		return "", backendErr
+	}
+	b := cpuBackend()
+	if backendForced != "" {
+		if backendForced.rank() > b.rank() {
+			return "", errBackendUnsupported
+		}
+		b = backendForced
+	}
+	return b, nil
+}
+
+// cmacBackend returns the AES-SIV-CMAC backend for
+// the backend limit b.
+func cmacBackend(b Backend) Backend {
+	if b.rank() >= BackendAESNI.rank() {
+		return BackendAESNI
+	}
+	return BackendGeneric
+}
+
+// gcmBackend returns the AES-GCM-SIV backend for
+// the backend limit b.
+func gcmBackend(b Backend) Backend {
+	if b == BackendAESNIPCLMUL {
+		return BackendAESNIPCLMUL
+	}
+	return BackendGeneric
+}
+
+// Implementation returns the backend used by an AEAD returned by
+// NewCMAC, NewCMACFromBlocks, NewGCM, NewGCMSIVFromBlock,
+// NewExtendedGCM, NewCommittingCMAC or NewCommittingGCM. It
+// returns an empty Backend for any other or a destroyed AEAD.
+func Implementation(c cipher.AEAD) Backend {
+	switch c := c.(type) {
+	case *aesSivCMac:
+		if c.aead != nil {
+			return c.aead.backend()
+		}
+	case *aesGcmSiv:
+		if c.aead != nil {
+			return c.aead.backend()
+		}
+	case *aesGcmSivExt:
+		if c.block != nil {
+			return gcmBackend(c.backend)
+		}
+	case *committingAEAD:
+		return Implementation(c.AEAD)
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// testBackends runs the test once for every
+// backend supported by the CPU.
+func testBackends(t *testing.T, test func(*testing.T)) {
+	defer SetBackend("")
+	for _, b := range Backends() {
+		if err := SetBackend(b); err != nil {
+			t.Fatalf("Failed to set backend %s: %v", b, err)
+		}
+		t.Run(string(b), test)
+	}
+}
+
+func TestImplementation(t *testing.T) { testBackends(t, testImplementation) }
+
+func testImplementation(t *testing.T) {
+	backend, err := selectBackend()
+	if err != nil {
+		t.Fatalf("Failed to select backend: %v", err)
+	}
+	cmac, _ := NewCMAC(make([]byte, 32))
+	gcm, _ := NewGCM(make([]byte, 16))
+	ext, _ := NewExtendedGCM(make([]byte, 16), 24)
+	committing, _ := NewCommittingCMAC(make([]byte, 32))
+	fromBlock, _ := NewGCMSIVFromBlock(aes.NewCipher, make([]byte, 16))
+
+	tests := []struct {
+		aead cipher.AEAD
+		want Backend
+	}{
+		{cmac, cmacBackend(backend)},
+		{gcm, gcmBackend(backend)},
+		{ext, gcmBackend(backend)},
+		{committing, cmacBackend(backend)},
+		{fromBlock, BackendGeneric},
+		{nil, ""},
+	}
+	for i, test := range tests {
+		if b := Implementation(test.aead); b != test.want {
+			t.Fatalf("Test %d: got backend %q - want %q", i, b, test.want)
+		}
+	}
+	cmac.(Destroyer).Destroy()
+	if b := Implementation(cmac); b != "" {
+		t.Fatalf("Destroyed AEAD uses backend %q", b)
+	}
+}
+
+func TestSetBackend(t *testing.T) {
+	defer SetBackend("")
+
+	if err := SetBackend("avx512"); err != errUnknownBackend {
+		t.Fatalf("SetBackend: got %v - want %v", err, errUnknownBackend)
+	}
+	if backends := Backends(); len(backends) < 3 {
+		if err := SetBackend(BackendAESNIPCLMUL); err != errBackendUnsupported {
+			t.Fatalf("SetBackend: got %v - want %v", err, errBackendUnsupported)
+		}
+	}
+
+	if err := setBackendDebug("foo=bar,backend=generic"); err != nil {
+		t.Fatalf("Failed to parse options: %v", err)
+	}
+	if b, _ := selectBackend(); b != BackendGeneric {
+		t.Fatalf("Backend %q selected - want %q", b, BackendGeneric)
+	}
+	if c, _ := NewGCM(make([]byte, 16)); Implementation(c) != BackendGeneric {
+		t.Fatalf("NewGCM uses backend %q - want %q", Implementation(c), BackendGeneric)
+	}
+	if err := setBackendDebug("backend=avx512"); err == nil {
+		t.Fatal("Parsed invalid backend option")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"hash"
+)
+
+// cmacHash implements CMAC (RFC 4493) for 128 bit block ciphers.
+// In contrast to an opaque hash.Hash its subkeys are stored in
+// memory provided - and wiped - by the caller.
+type cmacHash struct {
+	block  cipher.Block
+	k1, k2 []byte
+
+	x, buf [16]byte
+	off    int
+}
+
+var _ hash.Hash = (*cmacHash)(nil)
+
+// newCMACHash returns a CMAC using the block cipher. It
+// computes the subkeys and stores them in the 32 byte
+// subkeys buffer.
+func newCMACHash(block cipher.Block, subkeys []byte) *cmacHash {
+	h := &cmacHash{block: block, k1: subkeys[:16], k2: subkeys[16:32]}
+	wipe(h.k1)
+	block.Encrypt(h.k1, h.k1)
+	dbl((*[16]byte)(h.k1))
+	copy(h.k2, h.k1)
+	dbl((*[16]byte)(h.k2))
+	return h
+}
+
+func (h *cmacHash) Size() int { return 16 }
+
+func (h *cmacHash) BlockSize() int { return 16 }
+
+func (h *cmacHash) Reset() {
+	wipe(h.x[:])
+	wipe(h.buf[:])
+	h.off = 0
+}
+
+func (h *cmacHash) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.off == len(h.buf) {
+			xorBlock(&h.x, h.buf[:])
+			h.block.Encrypt(h.x[:], h.x[:])
+			h.off = 0
+		}
+		for h.off == 0 && len(p) > len(h.buf) {
+			xorBlock(&h.x, p)
+			h.block.Encrypt(h.x[:], h.x[:])
+			p = p[len(h.buf):]
+		}
+		c := copy(h.buf[h.off:], p)
+		h.off += c
+		p = p[c:]
+	}
+	return n, nil
+}
+
+func (h *cmacHash) Sum(b []byte) []byte {
+	x, last := h.x, h.buf
+	if h.off == len(last) {
+		xorBlock(&x, h.k1)
+	} else {
+		last[h.off] = 0x80
+		for i := h.off + 1; i < len(last); i++ {
+			last[i] = 0
+		}
+		xorBlock(&x, h.k2)
+	}
+	xorBlock(&x, last[:])
+	h.block.Encrypt(x[:], x[:])
+	wipe(last[:])
+	return append(b, x[:]...)
+}
+
+// destroy wipes the internal state and - if possible -
+// the block cipher. The subkeys must be wiped by the
+// caller.
+func (h *cmacHash) destroy() {
+	h.Reset()
+	wipeBlock(h.block)
+	h.block, h.k1, h.k2 = nil, nil, nil
+}
+
+func xorBlock(dst *[16]byte, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+var cmacTests = []struct {
+	msg, tag string
+}{
+	{"", "bb1d6929e95937287fa37d129b756746"},
+	{"6bc1bee22e409f96e93d7e117393172a", "070a16b46b4d4144f79bdd9dd04a287c"},
+	{"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411", "dfa66747de9ae63030ca32611497c827"},
+	{"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710", "51f0bebf7e3b9d92fc49741779363cfe"},
+}
+
+func TestCMACHash(t *testing.T) {
+	block, _ := aes.NewCipher(mustDecode("2b7e151628aed2a6abf7158809cf4f3c"))
+	h := newCMACHash(block, make([]byte, 32))
+	for i, v := range cmacTests {
+		msg, tag := mustDecode(v.msg), mustDecode(v.tag)
+		for _, n := range []int{1, 7, 16, 17, 64} {
+			h.Reset()
+			for p := msg; len(p) > 0; {
+				c := n
+				if c > len(p) {
+					c = len(p)
+				}
+				h.Write(p[:c])
+				p = p[c:]
+			}
+			if sum := h.Sum(nil); !bytes.Equal(sum, tag) {
+				t.Fatalf("Test %d: chunk size %d: got %x - want %x", i, n, sum, tag)
+			}
+			if sum := h.Sum(nil); !bytes.Equal(sum, tag) {
+				t.Fatalf("Test %d: Sum modified the CMAC state", i)
+			}
+		}
+	}
+}
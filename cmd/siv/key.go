@@ -0,0 +1,36 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// Key files contain a single PEM-encoded siv.Key - see
+// siv.Key.MarshalPEM. The algorithm names and IDs are the
+// ones of siv.Algorithm.
+
+func generateKey(alg siv.Algorithm) ([]byte, error) {
+	k, err := siv.GenerateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	return k.MarshalPEM()
+}
+
+func loadKey(path string) (*siv.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := siv.ParsePEMKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return k, nil
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Command siv seals and opens files and pipes using AES-GCM-SIV
+// or AES-SIV-CMAC.
+//
+// Usage:
+//
+//	siv keygen  [-alg algorithm] [-out file]
+//	siv seal    -key file [-ad string | -adfile file] [-chunk size] [-in file] [-out file]
+//	siv open    -key file [-ad string | -adfile file] [-in file] [-out file]
+//	siv rewrap  -key file -newkey file [-ad string | -adfile file] [-in file] [-out file]
+//	siv inspect [-in file]
+//
+// Data is read from standard input and written to standard output
+// unless -in or -out is given. The supported algorithms are
+// AES-128-GCM-SIV, AES-256-GCM-SIV (default), AES-128-SIV,
+// AES-192-SIV and AES-256-SIV. Key files are PEM-encoded siv.Key
+// values and every encrypted chunk is a siv envelope. Hence, keys
+// and chunks can be processed with the siv package as well.
+//
+// Data is encrypted in chunks such that arbitrarily large inputs
+// can be streamed. When opening, only authentic chunks are written
+// to the output. However, if authentication fails the output may
+// contain a prefix of the plaintext.
+//
+// Exit codes:
+//
+//	0  success
+//	1  other error - e.g. an I/O error or an invalid header
+//	2  usage error
+//	3  authentication failed - the data or AD has been modified
+//	4  wrong key - the data was encrypted with another key
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitAuth     = 3
+	exitWrongKey = 4
+)
+
+const usage = `usage: siv <command> [flags]
+
+Commands:
+  keygen   generate a new key file
+  seal     encrypt data
+  open     decrypt data
+  rewrap   re-encrypt data with a new key
+  inspect  print the header of encrypted data
+
+Run 'siv <command> -h' for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// usageError is returned if the command line is invalid.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd := &command{stdin: stdin, stdout: stdout, flags: flag.NewFlagSet("siv "+args[0], flag.ContinueOnError)}
+	cmd.flags.SetOutput(stderr)
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = cmd.keygen(args[1:])
+	case "seal":
+		err = cmd.seal(args[1:])
+	case "open":
+		err = cmd.open(args[1:])
+	case "rewrap":
+		err = cmd.rewrap(args[1:])
+	case "inspect":
+		err = cmd.inspect(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "siv: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+	if err == nil {
+		return exitOK
+	}
+	if err == flag.ErrHelp {
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "siv %s: %v\n", args[0], err)
+	var usageErr usageError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case err == errAuth:
+		return exitAuth
+	case err == errWrongKey:
+		return exitWrongKey
+	default:
+		return exitError
+	}
+}
+
+type command struct {
+	stdin  io.Reader
+	stdout io.Writer
+	flags  *flag.FlagSet
+
+	in, out        string
+	ad, adFile     string
+	keyFile        string
+	closeAfterDone []io.Closer
+}
+
+func (c *command) parse(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if c.flags.NArg() != 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", c.flags.Arg(0))}
+	}
+	return nil
+}
+
+func (c *command) ioFlags() {
+	c.flags.StringVar(&c.in, "in", "", "read from `file` instead of standard input")
+	c.flags.StringVar(&c.out, "out", "", "write to `file` instead of standard output")
+}
+
+func (c *command) keyFlags() {
+	c.flags.StringVar(&c.keyFile, "key", "", "the key `file`")
+	c.flags.StringVar(&c.ad, "ad", "", "the additional data `string`")
+	c.flags.StringVar(&c.adFile, "adfile", "", "read the additional data from `file`")
+}
+
+func (c *command) additionalData() ([]byte, error) {
+	if c.ad != "" && c.adFile != "" {
+		return nil, usageError{"-ad and -adfile are mutually exclusive"}
+	}
+	if c.adFile != "" {
+		return os.ReadFile(c.adFile)
+	}
+	return []byte(c.ad), nil
+}
+
+func (c *command) loadKey(path, name string) (*siv.Key, error) {
+	if path == "" {
+		return nil, usageError{fmt.Sprintf("missing -%s flag", name)}
+	}
+	return loadKey(path)
+}
+
+func (c *command) input() (io.Reader, error) {
+	if c.in == "" {
+		return c.stdin, nil
+	}
+	f, err := os.Open(c.in)
+	if err != nil {
+		return nil, err
+	}
+	c.closeAfterDone = append(c.closeAfterDone, f)
+	return f, nil
+}
+
+// output returns the output writer and a function that must
+// be called once all data has been written successfully.
+func (c *command) output() (io.Writer, func() error, error) {
+	if c.out == "" {
+		return c.stdout, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(c.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func (c *command) close() {
+	for _, closer := range c.closeAfterDone {
+		closer.Close()
+	}
+}
+
+func (c *command) keygen(args []string) error {
+	alg := c.flags.String("alg", siv.AES256GCMSIV.String(), "the `algorithm` of the key")
+	c.flags.StringVar(&c.out, "out", "", "write the key to `file` instead of standard output")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	a, err := siv.ParseAlgorithm(*alg)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	data, err := generateKey(a)
+	if err != nil {
+		return err
+	}
+	w, done, err := c.output()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		done()
+		return err
+	}
+	return done()
+}
+
+func (c *command) seal(args []string) error {
+	c.keyFlags()
+	c.ioFlags()
+	chunkSize := c.flags.Int("chunk", defaultChunkSize, "the chunk `size` in bytes")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *chunkSize <= 0 || *chunkSize > maxChunkSize {
+		return usageError{fmt.Sprintf("chunk size must be between 1 and %d", maxChunkSize)}
+	}
+	k, err := c.loadKey(c.keyFile, "key")
+	if err != nil {
+		return err
+	}
+	return c.transform(func(dst io.Writer, src io.Reader, ad []byte) error {
+		return seal(dst, src, k, ad, *chunkSize)
+	})
+}
+
+func (c *command) open(args []string) error {
+	c.keyFlags()
+	c.ioFlags()
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	k, err := c.loadKey(c.keyFile, "key")
+	if err != nil {
+		return err
+	}
+	return c.transform(func(dst io.Writer, src io.Reader, ad []byte) error {
+		return open(dst, src, k, ad)
+	})
+}
+
+func (c *command) rewrap(args []string) error {
+	c.keyFlags()
+	c.ioFlags()
+	newKeyFile := c.flags.String("newkey", "", "the new key `file`")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	oldKey, err := c.loadKey(c.keyFile, "key")
+	if err != nil {
+		return err
+	}
+	newKey, err := c.loadKey(*newKeyFile, "newkey")
+	if err != nil {
+		return err
+	}
+	return c.transform(func(dst io.Writer, src io.Reader, ad []byte) error {
+		// Read the header to keep the chunk size.
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(src, header); err != nil {
+			return errHeader
+		}
+		h, _, err := readHeader(bytes.NewReader(header))
+		if err != nil {
+			return err
+		}
+		src = io.MultiReader(bytes.NewReader(header), src)
+
+		r, w := io.Pipe()
+		errc := make(chan error, 1)
+		go func() {
+			err := open(w, src, oldKey, ad)
+			w.CloseWithError(err)
+			errc <- err
+		}()
+		if err = seal(dst, r, newKey, ad, int(h.chunkSize)); err != nil {
+			r.CloseWithError(err)
+			if openErr := <-errc; openErr != nil {
+				return openErr
+			}
+			return err
+		}
+		return <-errc
+	})
+}
+
+func (c *command) inspect(args []string) error {
+	c.flags.StringVar(&c.in, "in", "", "read from `file` instead of standard input")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	src, err := c.input()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	h, _, err := readHeader(src)
+	if err != nil {
+		return err
+	}
+	e, err := inspectChunk(src, h)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.stdout, "version:    %d\nalgorithm:  %s\nkey id:     %08x\nchunk size: %d\n",
+		h.version, e.Algorithm, e.KeyID, h.chunkSize)
+	return err
+}
+
+// transform reads the input, passes it to fn and writes the
+// result to the output.
+func (c *command) transform(fn func(dst io.Writer, src io.Reader, ad []byte) error) error {
+	ad, err := c.additionalData()
+	if err != nil {
+		return err
+	}
+	src, err := c.input()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	dst, done, err := c.output()
+	if err != nil {
+		return err
+	}
+	if err = fn(dst, src, ad); err != nil {
+		done()
+		return err
+	}
+	return done()
+}
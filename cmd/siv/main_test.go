@@ -0,0 +1,175 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// runCmd runs the command and returns its exit code and output.
+func runCmd(t *testing.T, stdin []byte, args ...string) (int, []byte) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.Bytes()
+}
+
+func keygen(t *testing.T, dir, alg string) string {
+	path := filepath.Join(dir, alg+".key")
+	if code, _ := runCmd(t, nil, "keygen", "-alg", alg, "-out", path); code != exitOK {
+		t.Fatalf("keygen %s: exit code %d", alg, code)
+	}
+	return path
+}
+
+func TestSealOpen(t *testing.T) {
+	dir := t.TempDir()
+	plaintext := make([]byte, 3*1024+17)
+	rand.New(rand.NewSource(1)).Read(plaintext)
+
+	for _, alg := range siv.Algorithms() {
+		keyFile := keygen(t, dir, alg.String())
+		for _, size := range []int{0, 1, 1024, len(plaintext)} {
+			code, ciphertext := runCmd(t, plaintext[:size], "seal", "-key", keyFile, "-ad", "context", "-chunk", "1024")
+			if code != exitOK {
+				t.Fatalf("%s/%d: seal: exit code %d", alg, size, code)
+			}
+			code, decrypted := runCmd(t, ciphertext, "open", "-key", keyFile, "-ad", "context")
+			if code != exitOK {
+				t.Fatalf("%s/%d: open: exit code %d", alg, size, code)
+			}
+			if !bytes.Equal(decrypted, plaintext[:size]) {
+				t.Fatalf("%s/%d: plaintext mismatch", alg, size)
+			}
+		}
+	}
+}
+
+func TestOpenFailures(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := keygen(t, dir, "AES-256-SIV")
+	otherKey := keygen(t, dir, "AES-128-GCM-SIV")
+	plaintext := bytes.Repeat([]byte("siv"), 1000)
+
+	_, ciphertext := runCmd(t, plaintext, "seal", "-key", keyFile, "-chunk", "1000")
+	chunkLen := 4 + 7 + 16 + 1000 + 16 // length, envelope header, nonce, chunk and tag
+	modified := append([]byte{}, ciphertext...)
+	modified[headerSize+chunkLen-1] ^= 1
+	swapped := append([]byte{}, ciphertext[:headerSize]...)
+	swapped = append(swapped, ciphertext[headerSize+chunkLen:headerSize+2*chunkLen]...)
+	swapped = append(swapped, ciphertext[headerSize:headerSize+chunkLen]...)
+	swapped = append(swapped, ciphertext[headerSize+2*chunkLen:]...)
+
+	tests := []struct {
+		name  string
+		input []byte
+		args  []string
+		code  int
+	}{
+		{"modified chunk", modified, []string{"-key", keyFile}, exitAuth},
+		{"swapped chunks", swapped, []string{"-key", keyFile}, exitAuth},
+		{"truncated at chunk", ciphertext[:headerSize+2*chunkLen], []string{"-key", keyFile}, exitAuth},
+		{"truncated chunk", ciphertext[:len(ciphertext)-1], []string{"-key", keyFile}, exitAuth},
+		{"wrong AD", ciphertext, []string{"-key", keyFile, "-ad", "other"}, exitAuth},
+		{"wrong key", ciphertext, []string{"-key", otherKey}, exitWrongKey},
+		{"invalid header", plaintext, []string{"-key", keyFile}, exitError},
+		{"missing key", ciphertext, nil, exitUsage},
+		{"ad and adfile", ciphertext, []string{"-key", keyFile, "-ad", "a", "-adfile", keyFile}, exitUsage},
+		{"unknown flag", ciphertext, []string{"-key", keyFile, "-unknown"}, exitUsage},
+	}
+	for _, test := range tests {
+		if code, _ := runCmd(t, test.input, append([]string{"open"}, test.args...)...); code != test.code {
+			t.Fatalf("%s: got exit code %d - want %d", test.name, code, test.code)
+		}
+	}
+	if code, _ := runCmd(t, nil, "unknown"); code != exitUsage {
+		t.Fatalf("unknown command: got exit code %d - want %d", code, exitUsage)
+	}
+	if code, _ := runCmd(t, nil, "keygen", "-alg", "AES-512-GCM"); code != exitUsage {
+		t.Fatalf("unknown algorithm: got exit code %d - want %d", code, exitUsage)
+	}
+}
+
+func TestRewrapInspect(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := keygen(t, dir, "AES-128-SIV")
+	newKey := keygen(t, dir, "AES-256-GCM-SIV")
+	plaintext := bytes.Repeat([]byte("rewrap"), 10000)
+
+	in, out := filepath.Join(dir, "data.siv"), filepath.Join(dir, "data.rewrapped")
+	if code, _ := runCmd(t, plaintext, "seal", "-key", oldKey, "-out", in, "-chunk", "4096"); code != exitOK {
+		t.Fatalf("seal: exit code %d", code)
+	}
+	if code, _ := runCmd(t, nil, "rewrap", "-key", oldKey, "-newkey", newKey, "-in", in, "-out", out); code != exitOK {
+		t.Fatalf("rewrap: exit code %d", code)
+	}
+	if code, _ := runCmd(t, nil, "open", "-key", oldKey, "-in", out); code != exitWrongKey {
+		t.Fatalf("open with old key: got exit code %d - want %d", code, exitWrongKey)
+	}
+	code, decrypted := runCmd(t, nil, "open", "-key", newKey, "-in", out)
+	if code != exitOK || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("open with new key: exit code %d", code)
+	}
+
+	k, err := loadKey(newKey)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	code, info := runCmd(t, nil, "inspect", "-in", out)
+	if code != exitOK {
+		t.Fatalf("inspect: exit code %d", code)
+	}
+	for _, want := range []string{"AES-256-GCM-SIV", fmt.Sprintf("%08x", k.ID()), "chunk size: 4096"} {
+		if !strings.Contains(string(info), want) {
+			t.Fatalf("inspect: %q not found in %q", want, info)
+		}
+	}
+
+	data, _ := os.ReadFile(in)
+	data[len(data)-1] ^= 1
+	code, _ = runCmd(t, data, "rewrap", "-key", oldKey, "-newkey", newKey)
+	if code != exitAuth {
+		t.Fatalf("rewrap of modified data: got exit code %d - want %d", code, exitAuth)
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := keygen(t, dir, "AES-256-SIV")
+	k, err := loadKey(keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load key file: %v", err)
+	}
+	if k.Algorithm() != siv.AES256SIV {
+		t.Fatalf("got algorithm %v - want %v", k.Algorithm(), siv.AES256SIV)
+	}
+
+	data, _ := os.ReadFile(keyFile)
+	if _, err = siv.ParsePEMKey(data); err != nil {
+		t.Fatalf("Key file is not a PEM-encoded siv.Key: %v", err)
+	}
+	modified := filepath.Join(dir, "modified.key")
+	os.WriteFile(modified, bytes.Replace(data, []byte("-----END"), []byte("-----END MODIFIED"), 1), 0600)
+	if _, err = loadKey(modified); err == nil {
+		t.Fatal("Loaded modified key file")
+	}
+
+	// Data sealed by the siv command is a sequence of siv envelopes.
+	_, ciphertext := runCmd(t, []byte("envelope"), "seal", "-key", keyFile)
+	e, err := siv.ParseEnvelope(ciphertext[headerSize+4:], nil)
+	if err != nil {
+		t.Fatalf("Failed to parse chunk envelope: %v", err)
+	}
+	if e.Algorithm != k.Algorithm() || e.KeyID != k.ID() {
+		t.Fatalf("Envelope does not match key: %+v", e)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// Encrypted data consists of a header followed by a sequence of
+// encrypted chunks:
+//
+//	magic "SIVS" (4 bytes) || version (1 byte) || reserved (3 bytes) ||
+//	chunk size (4 bytes, big-endian) || stream ID (16 bytes, random)
+//
+// Every chunk is a siv envelope - see siv.SealEnvelope - preceded by
+// its length (4 bytes, big-endian). The envelope carries the algorithm
+// and the ID of the key. Every chunk but the last one contains exactly
+// chunk size plaintext bytes. The last chunk - which may be empty -
+// contains the remaining bytes. The additional data of a chunk is:
+//
+//	header || counter (8 bytes, big-endian) || final (1 byte) || AD
+//
+// where final is 1 for the last chunk and 0 otherwise. Hence,
+// reordered, dropped or truncated chunks are detected. The random
+// stream ID ensures that chunks cannot be moved between streams.
+const (
+	headerSize       = 28
+	headerVersion    = 1
+	defaultChunkSize = 64 * 1024
+	maxChunkSize     = 1 << 24
+
+	// maxEnvelopeOverhead is an upper bound for the envelope
+	// header, nonce and tag of a chunk.
+	maxEnvelopeOverhead = 64
+)
+
+var headerMagic = [4]byte{'S', 'I', 'V', 'S'}
+
+var (
+	errHeader   = errors.New("invalid header")
+	errWrongKey = errors.New("data is not encrypted with the given key")
+	errAuth     = errors.New("authentication failed")
+	errTooMany  = errors.New("too many chunks")
+)
+
+type header struct {
+	version   byte
+	chunkSize uint32
+	streamID  [16]byte
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, headerSize)
+	copy(b, headerMagic[:])
+	b[4] = h.version
+	binary.BigEndian.PutUint32(b[8:], h.chunkSize)
+	copy(b[12:], h.streamID[:])
+	return b
+}
+
+func readHeader(r io.Reader) (*header, []byte, error) {
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errHeader
+		}
+		return nil, nil, err
+	}
+	if !bytes.Equal(b[:4], headerMagic[:]) || b[4] != headerVersion || b[5] != 0 || b[6] != 0 || b[7] != 0 {
+		return nil, nil, errHeader
+	}
+	h := &header{version: b[4], chunkSize: binary.BigEndian.Uint32(b[8:])}
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+		return nil, nil, errHeader
+	}
+	copy(h.streamID[:], b[12:])
+	return h, b, nil
+}
+
+// readChunk reads the next length-prefixed envelope from r.
+// It returns io.EOF if r contains no more data.
+func readChunk(r *bufio.Reader, chunkSize uint32) (envelope []byte, final bool, err error) {
+	var length [4]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errAuth
+		}
+		return nil, false, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > chunkSize+maxEnvelopeOverhead {
+		return nil, false, errAuth
+	}
+	envelope = make([]byte, n)
+	if _, err = io.ReadFull(r, envelope); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errAuth
+		}
+		return nil, false, err
+	}
+	if _, err = r.Peek(1); err == io.EOF {
+		return envelope, true, nil
+	}
+	return envelope, false, err
+}
+
+// stream computes the additional data of the chunks of one message.
+type stream struct {
+	header  []byte
+	ad      []byte
+	counter uint64
+}
+
+func (s *stream) next(final bool) ([]byte, error) {
+	if s.counter == ^uint64(0) {
+		return nil, errTooMany
+	}
+	ad := make([]byte, 0, len(s.header)+9+len(s.ad))
+	ad = append(ad, s.header...)
+	ad = append(ad, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(ad[len(s.header):], s.counter)
+	if final {
+		ad = append(ad, 1)
+	} else {
+		ad = append(ad, 0)
+	}
+	ad = append(ad, s.ad...)
+	s.counter++
+	return ad, nil
+}
+
+// seal encrypts src with the key and the additional data ad
+// and writes the header and the encrypted chunks to dst.
+func seal(dst io.Writer, src io.Reader, k *siv.Key, ad []byte, chunkSize int) error {
+	h := &header{version: headerVersion, chunkSize: uint32(chunkSize)}
+	if _, err := io.ReadFull(rand.Reader, h.streamID[:]); err != nil {
+		return err
+	}
+	s := &stream{header: h.marshal(), ad: ad}
+	if _, err := dst.Write(s.header); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(src)
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final := err != nil
+		if !final {
+			if _, err = r.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+		chunkAD, err := s.next(final)
+		if err != nil {
+			return err
+		}
+		envelope, err := siv.SealEnvelope(k, buf[:n], chunkAD)
+		if err != nil {
+			return err
+		}
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(envelope)))
+		if _, err = dst.Write(append(length[:], envelope...)); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// open decrypts the encrypted data read from src with the key
+// and the additional data ad and writes the plaintext to dst.
+// Only authentic chunks are written to dst. However, if open
+// fails, dst may contain a prefix of the plaintext.
+func open(dst io.Writer, src io.Reader, k *siv.Key, ad []byte) error {
+	r := bufio.NewReader(src)
+	h, hb, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	s := &stream{header: hb, ad: ad}
+	lookup := func(uint32) (*siv.Key, error) { return k, nil }
+	for {
+		envelope, final, err := readChunk(r, h.chunkSize)
+		if err == io.EOF {
+			return errAuth
+		}
+		if err != nil {
+			return err
+		}
+		e, err := siv.ParseEnvelope(envelope, nil)
+		if err != nil {
+			return errAuth
+		}
+		if e.Algorithm != k.Algorithm() || e.KeyID != k.ID() {
+			return errWrongKey
+		}
+		chunkAD, err := s.next(final)
+		if err != nil {
+			return err
+		}
+		plaintext, err := siv.OpenEnvelope(envelope, chunkAD, nil, lookup)
+		if err != nil {
+			return errAuth
+		}
+		if _, err = dst.Write(plaintext); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// inspectChunk returns the envelope of the first chunk
+// following the header.
+func inspectChunk(r io.Reader, h *header) (*siv.Envelope, error) {
+	envelope, _, err := readChunk(bufio.NewReader(r), h.chunkSize)
+	if err == io.EOF || err == errAuth {
+		return nil, errHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	return siv.ParseEnvelope(envelope, nil)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+var (
+	errNoColumn   = errors.New("siv: no column key")
+	errScanNull   = errors.New("siv: cannot scan NULL into encrypted column value")
+	errScanType   = errors.New("siv: unsupported type for encrypted column value")
+	errColumnData = errors.New("siv: encrypted column value is too short")
+)
+
+// DeterministicColumn encrypts the values of a database column
+// deterministically using AES-SIV-CMAC with an empty nonce. The
+// same value always encrypts to the same ciphertext such that the
+// column supports equality queries and unique indexes - but also
+// reveals which rows share a value.
+type DeterministicColumn struct {
+	aead cipher.AEAD
+	ad   []byte
+}
+
+// NewDeterministicColumn returns a DeterministicColumn for the
+// given table and column. The key must be either 32, 48 or 64
+// bytes long and should be unique for every column.
+//
+// The table and column names are bound as additional data:
+// table || 0x00 || column. Therefore, values cannot be copied
+// between columns.
+func NewDeterministicColumn(key []byte, table, column string) (*DeterministicColumn, error) {
+	aead, err := NewCMAC(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DeterministicColumn{aead: aead, ad: columnAD(table, column)}, nil
+}
+
+// RandomizedColumn encrypts the values of a database column using
+// AES-GCM-SIV with a random nonce. Encrypting the same value twice
+// produces different ciphertexts. Hence, the column does not
+// support equality queries.
+type RandomizedColumn struct {
+	aead cipher.AEAD
+	ad   []byte
+}
+
+// NewRandomizedColumn returns a RandomizedColumn for the given
+// table and column. The key must be either 16 or 32 bytes long
+// and should be unique for every column.
+//
+// The table and column names are bound as additional data:
+// table || 0x00 || column. Therefore, values cannot be copied
+// between columns.
+func NewRandomizedColumn(key []byte, table, column string) (*RandomizedColumn, error) {
+	aead, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &RandomizedColumn{aead: aead, ad: columnAD(table, column)}, nil
+}
+
+func columnAD(table, column string) []byte {
+	ad := make([]byte, 0, len(table)+1+len(column))
+	ad = append(ad, table...)
+	ad = append(ad, 0)
+	return append(ad, column...)
+}
+
+// DeterministicString is a string stored encrypted in a column
+// of a DeterministicColumn. It implements driver.Valuer and
+// sql.Scanner. The Column must be set before scanning.
+//
+//	email := siv.DeterministicString{Column: emailColumn, String: "alice@example.com"}
+//	db.QueryRow("SELECT id FROM users WHERE email = $1", email)
+type DeterministicString struct {
+	Column *DeterministicColumn
+	String string
+}
+
+var (
+	_ driver.Valuer = DeterministicString{}
+	_ sql.Scanner   = (*DeterministicString)(nil)
+)
+
+// Value returns the encrypted string.
+func (s DeterministicString) Value() (driver.Value, error) {
+	if s.Column == nil {
+		return nil, errNoColumn
+	}
+	return s.Column.aead.Seal(nil, nil, []byte(s.String), s.Column.ad), nil
+}
+
+// Scan decrypts src and sets s.String. It returns an error
+// if src is not authentic.
+func (s *DeterministicString) Scan(src interface{}) error {
+	if s.Column == nil {
+		return errNoColumn
+	}
+	ciphertext, err := scanBytes(src)
+	if err != nil {
+		return err
+	}
+	plaintext, err := s.Column.aead.Open(nil, nil, ciphertext, s.Column.ad)
+	if err != nil {
+		return err
+	}
+	s.String = string(plaintext)
+	return nil
+}
+
+// RandomizedBytes is a byte slice stored encrypted in a column
+// of a RandomizedColumn. It implements driver.Valuer and
+// sql.Scanner. The Column must be set before scanning.
+//
+// The encrypted value consists of the 12 byte random nonce
+// followed by the AES-GCM-SIV ciphertext.
+type RandomizedBytes struct {
+	Column *RandomizedColumn
+	Bytes  []byte
+}
+
+var (
+	_ driver.Valuer = RandomizedBytes{}
+	_ sql.Scanner   = (*RandomizedBytes)(nil)
+)
+
+// Value returns the encrypted bytes.
+func (b RandomizedBytes) Value() (driver.Value, error) {
+	if b.Column == nil {
+		return nil, errNoColumn
+	}
+	nonceSize := b.Column.aead.NonceSize()
+	ciphertext := make([]byte, nonceSize, nonceSize+len(b.Bytes)+b.Column.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, ciphertext); err != nil {
+		return nil, err
+	}
+	return b.Column.aead.Seal(ciphertext, ciphertext[:nonceSize], b.Bytes, b.Column.ad), nil
+}
+
+// Scan decrypts src and sets b.Bytes. It returns an error
+// if src is not authentic.
+func (b *RandomizedBytes) Scan(src interface{}) error {
+	if b.Column == nil {
+		return errNoColumn
+	}
+	ciphertext, err := scanBytes(src)
+	if err != nil {
+		return err
+	}
+	nonceSize := b.Column.aead.NonceSize()
+	if len(ciphertext) < nonceSize+b.Column.aead.Overhead() {
+		return errColumnData
+	}
+	plaintext, err := b.Column.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], b.Column.ad)
+	if err != nil {
+		return err
+	}
+	b.Bytes = plaintext
+	return nil
+}
+
+func scanBytes(src interface{}) ([]byte, error) {
+	switch src := src.(type) {
+	case []byte:
+		return src, nil
+	case string:
+		return []byte(src), nil
+	case nil:
+		return nil, errScanNull
+	default:
+		return nil, errScanType
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver is an in-memory database/sql driver storing
+// rows with two columns. It supports two statements:
+//
+//	INSERT                 - inserts the two arguments as row
+//	SELECT [WHERE first=?] - returns all rows or all rows with
+//	                         a matching first column
+type fakeDriver struct {
+	mu   sync.Mutex
+	rows [][]driver.Value
+}
+
+func init() { sql.Register("siv-fake", new(fakeDriver)) }
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT") || len(args) != 2 {
+		return nil, errors.New("invalid statement")
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.rows = append(s.d.rows, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, errors.New("invalid statement")
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	rows := &fakeRows{}
+	for _, row := range s.d.rows {
+		if len(args) == 0 || bytes.Equal(row[0].([]byte), args[0].([]byte)) {
+			rows.rows = append(rows.rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"email", "ssn"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestColumn(t *testing.T) {
+	email, err := NewDeterministicColumn(make([]byte, 64), "users", "email")
+	if err != nil {
+		t.Fatalf("Failed to create deterministic column: %v", err)
+	}
+	ssn, err := NewRandomizedColumn(make([]byte, 32), "users", "ssn")
+	if err != nil {
+		t.Fatalf("Failed to create randomized column: %v", err)
+	}
+	db, err := sql.Open("siv-fake", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	users := []struct{ email, ssn string }{
+		{"alice@example.com", "078-05-1120"},
+		{"bob@example.com", "219-09-9999"},
+		{"carol@example.com", "078-05-1120"},
+	}
+	for i, u := range users {
+		_, err := db.Exec("INSERT", DeterministicString{email, u.email}, RandomizedBytes{ssn, []byte(u.ssn)})
+		if err != nil {
+			t.Fatalf("Test %d: INSERT failed: %v", i, err)
+		}
+	}
+
+	for i, u := range users {
+		e, s := DeterministicString{Column: email}, RandomizedBytes{Column: ssn}
+		err := db.QueryRow("SELECT WHERE", DeterministicString{email, u.email}).Scan(&e, &s)
+		if err != nil {
+			t.Fatalf("Test %d: SELECT failed: %v", i, err)
+		}
+		if e.String != u.email || string(s.Bytes) != u.ssn {
+			t.Fatalf("Test %d: got %q, %q - want %q, %q", i, e.String, s.Bytes, u.email, u.ssn)
+		}
+	}
+
+	// The same SSN must not produce the same ciphertext.
+	fake := db.Driver().(*fakeDriver)
+	if bytes.Equal(fake.rows[0][1].([]byte), fake.rows[2][1].([]byte)) {
+		t.Fatal("Randomized encryption produced equal ciphertexts")
+	}
+
+	// Values must not be movable between columns.
+	other, _ := NewDeterministicColumn(make([]byte, 64), "users", "name")
+	e := DeterministicString{Column: other}
+	if err = e.Scan(fake.rows[0][0]); err == nil {
+		t.Fatal("Scan succeeded for value of other column")
+	}
+	s := RandomizedBytes{Column: ssn}
+	if err = s.Scan(append([]byte{}, fake.rows[0][0].([]byte)...)); err == nil {
+		t.Fatal("Scan succeeded for value of other column")
+	}
+	if err = s.Scan(nil); err == nil {
+		t.Fatal("Scan succeeded for NULL")
+	}
+	if _, err = (DeterministicString{String: "no column"}).Value(); err == nil {
+		t.Fatal("Value succeeded without column")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// commitmentSize is the size of the key commitment prepended
+// to every ciphertext of a key-committing AEAD.
+const commitmentSize = sha256.Size
+
+// NewCommittingGCM returns a key-committing cipher.AEAD based on
+// AES-GCM-SIV. The key must be either 16 or 32 bytes long.
+//
+// AES-GCM-SIV itself is not key-committing: a ciphertext can be
+// crafted such that it decrypts successfully under two different
+// keys. The returned AEAD derives a commitment block and an
+// AES-GCM-SIV key from the key using HMAC-SHA256:
+//
+//	commitment = HMAC-SHA256(key, "siv-go AES-GCM-SIV commitment")
+//	encKey     = KDF(key, "siv-go AES-GCM-SIV encryption", len(key))
+//
+// where KDF is the SP 800-108 counter-mode KDF with HMAC-SHA256.
+// A ciphertext has the following wire format:
+//
+//	commitment (32 bytes) || AES-GCM-SIV(encKey, nonce, plaintext, additionalData)
+//
+// Open rejects any ciphertext whose commitment does not match the
+// key. Hence, a ciphertext can only be decrypted by the key it was
+// created with - unless an attacker finds an HMAC-SHA256 collision.
+// The construction follows the "commitment block" approach
+// recommended by Albertini et al. and Bellare and Hoang.
+func NewCommittingGCM(key []byte) (cipher.AEAD, error) {
+	if k := len(key); k != 16 && k != 32 {
+		return nil, aes.KeySizeError(k)
+	}
+	commitment, encKey := deriveCommitment(key, "AES-GCM-SIV")
+	c, err := NewGCM(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return &committingAEAD{AEAD: c, commitment: commitment}, nil
+}
+
+// NewCommittingCMAC returns a key-committing cipher.AEAD based on
+// AES-SIV-CMAC. The key must be either 32, 48 or 64 bytes long.
+//
+// The commitment block and the AES-SIV-CMAC key are derived in the
+// same way as for NewCommittingGCM - just with "AES-SIV-CMAC" instead
+// of "AES-GCM-SIV" as part of the labels. A ciphertext has the
+// following wire format:
+//
+//	commitment (32 bytes) || AES-SIV-CMAC(encKey, nonce, plaintext, additionalData)
+//
+// The returned cipher.AEAD accepts an empty or NonceSize()
+// bytes long nonce.
+func NewCommittingCMAC(key []byte) (cipher.AEAD, error) {
+	if k := len(key); k != 32 && k != 48 && k != 64 {
+		return nil, aes.KeySizeError(k)
+	}
+	commitment, encKey := deriveCommitment(key, "AES-SIV-CMAC")
+	c, err := NewCMAC(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return &committingAEAD{AEAD: c, commitment: commitment}, nil
+}
+
+type committingAEAD struct {
+	cipher.AEAD
+	commitment [commitmentSize]byte
+}
+
+func (c *committingAEAD) Overhead() int { return commitmentSize + c.AEAD.Overhead() }
+
+// Seal writes the commitment after the inner AEAD has encrypted
+// the plaintext. Otherwise, the commitment would overwrite the
+// plaintext if it shares its memory with dst.
+func (c *committingAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	ret, out := sliceForAppend(dst, c.Overhead()+len(plaintext))
+	if anyOverlap(out, plaintext) {
+		plaintext = append(make([]byte, 0, len(plaintext)), plaintext...)
+		defer wipe(plaintext)
+	}
+	c.AEAD.Seal(out[commitmentSize:commitmentSize], nonce, plaintext, additionalData)
+	copy(out, c.commitment[:])
+	return ret
+}
+
+func (c *committingAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < c.Overhead() {
+		return dst, errOpen
+	}
+	if subtle.ConstantTimeCompare(ciphertext[:commitmentSize], c.commitment[:]) != 1 {
+		return dst, errOpen
+	}
+	ciphertext = ciphertext[commitmentSize:]
+	if anyOverlap(dst[len(dst):cap(dst)], ciphertext) {
+		ciphertext = append(make([]byte, 0, len(ciphertext)), ciphertext...)
+	}
+	return c.AEAD.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// deriveCommitment derives the commitment block and an encryption
+// key of len(key) bytes from key. The algorithm name is used for
+// domain separation.
+func deriveCommitment(key []byte, algorithm string) (commitment [commitmentSize]byte, encKey []byte) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("siv-go " + algorithm + " commitment"))
+	mac.Sum(commitment[:0])
+
+	label := []byte("siv-go " + algorithm + " encryption")
+	var ctr, length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(8*len(key)))
+	for i := uint32(1); len(encKey) < len(key); i++ {
+		mac.Reset()
+		binary.BigEndian.PutUint32(ctr[:], i)
+		mac.Write(ctr[:])
+		mac.Write(label)
+		mac.Write([]byte{0})
+		mac.Write(length[:])
+		encKey = mac.Sum(encKey)
+	}
+	return commitment, encKey[:len(key)]
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+)
+
+var committingTests = []struct {
+	new    func([]byte) (cipher.AEAD, error)
+	key    string
+	other  string
+	vector vector
+}{
+	{
+		new:   NewCommittingGCM,
+		key:   "000102030405060708090a0b0c0d0e0f",
+		other: "0f0e0d0c0b0a09080706050403020100",
+		vector: vector{
+			plaintext:      "6b65792d636f6d6d697474696e6720706c61696e74657874",
+			additionalData: "6164",
+			nonce:          "030000000000000000000000",
+			ciphertext:     "f4a6e11fb9de941631619477cc9068cd1e5d5f08ecdaf7b4467d7c9ee8ff6687543b4e2d9e18e18166e1c6b70009dfb67be3baadb8bb99d382fa8d160408002eafa25b0018e6a992",
+		},
+	},
+	{
+		new:   NewCommittingCMAC,
+		key:   "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		other: "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100",
+		vector: vector{
+			plaintext:      "6b65792d636f6d6d697474696e6720706c61696e74657874",
+			additionalData: "6164",
+			nonce:          "101112131415161718191a1b1c1d1e1f",
+			ciphertext:     "ce6fd4bd8a01f473bebfd2f2c37e3f822e976df59c26d8b931fb6d47148cae91799cbcdbce5f248461bdf932c281f2113c12138e3dee4b6ce91ec6a204f2be48d8b2ed9405ad9278",
+		},
+	},
+}
+
+func TestCommitting(t *testing.T) {
+	for i, test := range committingTests {
+		v := test.vector
+		c, err := test.new(mustDecode(test.key))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create committing AEAD: %v", i, err)
+		}
+		ciphertext := c.Seal(nil, v.Nonce(), v.Plaintext(), v.AdditionalData())
+		if !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: Seal - ciphertext mismatch: %s - %s", i, v.ciphertext, hex.EncodeToString(ciphertext))
+		}
+		plaintext, err := c.Open(nil, v.Nonce(), ciphertext, v.AdditionalData())
+		if err != nil {
+			t.Errorf("Test %d: Open failed - %v", i, err)
+		}
+		if !bytes.Equal(plaintext, v.Plaintext()) {
+			t.Errorf("Test %d: Open - plaintext mismatch", i)
+		}
+
+		// Seal and Open must work in place - i.e. with
+		// plaintext[:0] resp. ciphertext[:0] as dst.
+		buf := make([]byte, len(v.Plaintext()), len(v.Plaintext())+c.Overhead())
+		copy(buf, v.Plaintext())
+		if ciphertext = c.Seal(buf[:0], v.Nonce(), buf, v.AdditionalData()); !bytes.Equal(ciphertext, v.Ciphertext()) {
+			t.Errorf("Test %d: in-place Seal - ciphertext mismatch: %s - %s", i, v.ciphertext, hex.EncodeToString(ciphertext))
+		}
+		if plaintext, err = c.Open(ciphertext[:0], v.Nonce(), ciphertext, v.AdditionalData()); err != nil {
+			t.Errorf("Test %d: in-place Open failed - %v", i, err)
+		}
+		if !bytes.Equal(plaintext, v.Plaintext()) {
+			t.Errorf("Test %d: in-place Open - plaintext mismatch", i)
+		}
+
+		other, err := test.new(mustDecode(test.other))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create committing AEAD: %v", i, err)
+		}
+		if _, err = other.Open(nil, v.Nonce(), ciphertext, v.AdditionalData()); err == nil {
+			t.Errorf("Test %d: Open succeeded under a different key", i)
+		}
+
+		// Replacing the commitment must not allow decryption under the
+		// other key since it commits to a different encryption key.
+		forged := append([]byte(nil), ciphertext...)
+		copy(forged, other.Seal(nil, v.Nonce(), nil, nil)[:commitmentSize])
+		if _, err = other.Open(nil, v.Nonce(), forged, v.AdditionalData()); err == nil {
+			t.Errorf("Test %d: Open succeeded with a replaced commitment", i)
+		}
+	}
+}
+
+func TestCommittingError(t *testing.T) {
+	defer func() { backendErr = nil }()
+	backendErr = errUnknownBackend
+
+	for i, test := range committingTests {
+		if _, err := test.new(mustDecode(test.key)); err != errUnknownBackend {
+			t.Errorf("Test %d: got error %v - want %v", i, err, errUnknownBackend)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxRecordSize is the maximum number of plaintext bytes
+	// a Conn puts into one record.
+	MaxRecordSize = 16 * 1024
+
+	// DefaultRekeyAfter is the default number of plaintext bytes
+	// after which a Conn ratchets the key of a direction forward.
+	DefaultRekeyAfter = 1 << 30
+)
+
+const (
+	recordHeaderSize = 3 // type (1 byte) || length (2 bytes)
+
+	recordData  byte = 0
+	recordClose byte = 1
+
+	// closeTimeout limits how long Close tries to send
+	// the close record if no earlier write deadline is set.
+	closeTimeout = 5 * time.Second
+)
+
+var (
+	errRecord    = errors.New("siv: invalid record")
+	errTruncated = errors.New("siv: connection truncated")
+	errSequence  = errors.New("siv: record sequence number overflow")
+)
+
+// ConnConfig configures a Conn. Both ends of a connection
+// must use the same configuration.
+type ConnConfig struct {
+	// RekeyAfter is the number of plaintext bytes after which
+	// the key of a direction is ratcheted forward. The ratchet
+	// takes place at the end of the record that reaches the
+	// limit. If zero, DefaultRekeyAfter is used.
+	RekeyAfter uint64
+}
+
+// Conn is a net.Conn that encrypts all data using AES-GCM-SIV.
+//
+// A Conn frames written data into length-prefixed records of at
+// most MaxRecordSize plaintext bytes. Each direction uses its own
+// key and the record sequence number as implicit nonce. Therefore,
+// replayed, reordered or dropped records fail to decrypt. Closing
+// a Conn sends a close record such that a truncated connection is
+// detected by the peer. The keys are ratcheted forward - and the
+// previous keys are discarded - after a configurable number of
+// bytes.
+//
+// A Conn does not perform any key exchange. Both peers must share
+// a secret key.
+type Conn struct {
+	conn       net.Conn
+	rekeyAfter uint64
+
+	in, out halfConn
+
+	inBuf []byte // decrypted but not yet read plaintext
+	inEOF bool   // whether the peer sent a close record
+
+	deadlineLock  sync.Mutex
+	writeDeadline time.Time // set by SetDeadline or SetWriteDeadline
+}
+
+type halfConn struct {
+	sync.Mutex
+	key   []byte
+	aead  cipher.AEAD
+	seq   uint64
+	bytes uint64 // bytes processed since the last key ratchet
+	err   error  // sticky error
+	buf   []byte
+}
+
+// Client returns a new client-side Conn using the default
+// configuration. The key must be either 16 or 32 bytes long.
+func Client(conn net.Conn, key []byte) (*Conn, error) {
+	return ClientWithConfig(conn, key, nil)
+}
+
+// Server returns a new server-side Conn using the default
+// configuration. The key must be either 16 or 32 bytes long.
+func Server(conn net.Conn, key []byte) (*Conn, error) {
+	return ServerWithConfig(conn, key, nil)
+}
+
+// ClientWithConfig is like Client but uses the given configuration.
+func ClientWithConfig(conn net.Conn, key []byte, config *ConnConfig) (*Conn, error) {
+	return newConn(conn, key, config, "client", "server")
+}
+
+// ServerWithConfig is like Server but uses the given configuration.
+func ServerWithConfig(conn net.Conn, key []byte, config *ConnConfig) (*Conn, error) {
+	return newConn(conn, key, config, "server", "client")
+}
+
+func newConn(conn net.Conn, key []byte, config *ConnConfig, local, remote string) (*Conn, error) {
+	if k := len(key); k != 16 && k != 32 {
+		return nil, aes.KeySizeError(k)
+	}
+	c := &Conn{conn: conn, rekeyAfter: DefaultRekeyAfter}
+	if config != nil && config.RekeyAfter > 0 {
+		c.rekeyAfter = config.RekeyAfter
+	}
+	if err := c.out.setKey(deriveConnKey(key, "siv-go conn "+local)); err != nil {
+		return nil, err
+	}
+	if err := c.in.setKey(deriveConnKey(key, "siv-go conn "+remote)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// deriveConnKey derives a len(key) bytes long key from
+// key and label using HMAC-SHA256.
+func deriveConnKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)[:len(key)]
+}
+
+func (h *halfConn) setKey(key []byte) error {
+	aead, err := NewGCM(key)
+	if err != nil {
+		return err
+	}
+	for i := range h.key {
+		h.key[i] = 0
+	}
+	h.key, h.aead, h.bytes = key, aead, 0
+	return nil
+}
+
+// ratchet replaces the current key with a key derived
+// from it once rekeyAfter bytes have been processed.
+func (h *halfConn) ratchet(n int, rekeyAfter uint64) error {
+	h.bytes += uint64(n)
+	if h.bytes >= rekeyAfter {
+		return h.setKey(deriveConnKey(h.key, "siv-go conn ratchet"))
+	}
+	return nil
+}
+
+func (h *halfConn) nonce() ([]byte, error) {
+	if h.seq == ^uint64(0) {
+		return nil, errSequence
+	}
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], h.seq)
+	h.seq++
+	return nonce, nil
+}
+
+// Write encrypts b and writes it to the underlying
+// connection as one or more records.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.out.Lock()
+	defer c.out.Unlock()
+
+	var n int
+	for len(b) > 0 {
+		m := len(b)
+		if m > MaxRecordSize {
+			m = MaxRecordSize
+		}
+		if err := c.writeRecord(recordData, b[:m]); err != nil {
+			return n, err
+		}
+		n += m
+		b = b[m:]
+	}
+	return n, nil
+}
+
+func (c *Conn) writeRecord(typ byte, plaintext []byte) error {
+	if c.out.err != nil {
+		return c.out.err
+	}
+	nonce, err := c.out.nonce()
+	if err != nil {
+		c.out.err = err
+		return err
+	}
+
+	size := len(plaintext) + c.out.aead.Overhead()
+	record := append(c.out.buf[:0], typ, byte(size>>8), byte(size))
+	record = c.out.aead.Seal(record, nonce, plaintext, record[:recordHeaderSize])
+	c.out.buf = record
+	if _, err = c.conn.Write(record); err != nil {
+		c.out.err = err
+		return err
+	}
+	if err = c.out.ratchet(len(plaintext), c.rekeyAfter); err != nil {
+		c.out.err = err
+		return err
+	}
+	return nil
+}
+
+// Read reads and decrypts data from the underlying connection.
+// It returns io.EOF once the peer has closed the connection and
+// an error if the connection has been truncated or a record has
+// been modified, replayed or reordered.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.in.Lock()
+	defer c.in.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for len(c.inBuf) == 0 {
+		if c.inEOF {
+			return 0, io.EOF
+		}
+		if err := c.readRecord(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.inBuf)
+	c.inBuf = c.inBuf[n:]
+	return n, nil
+}
+
+func (c *Conn) readRecord() error {
+	if c.in.err != nil {
+		return c.in.err
+	}
+
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		if err == io.EOF {
+			err = errTruncated // EOF before the close record
+		} else if err == io.ErrUnexpectedEOF {
+			err = errTruncated
+		}
+		c.in.err = err
+		return err
+	}
+	size := int(binary.BigEndian.Uint16(header[1:]))
+	if size < c.in.aead.Overhead() || size > MaxRecordSize+c.in.aead.Overhead() {
+		c.in.err = errRecord
+		return errRecord
+	}
+	if cap(c.in.buf) < size {
+		c.in.buf = make([]byte, size)
+	}
+	record := c.in.buf[:size]
+	if _, err := io.ReadFull(c.conn, record); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errTruncated
+		}
+		c.in.err = err
+		return err
+	}
+
+	nonce, err := c.in.nonce()
+	if err != nil {
+		c.in.err = err
+		return err
+	}
+	plaintext, err := c.in.aead.Open(record[:0], nonce, record, header[:])
+	if err != nil {
+		c.in.err = err
+		return err
+	}
+	switch header[0] {
+	case recordData:
+		c.inBuf = plaintext
+	case recordClose:
+		if len(plaintext) != 0 {
+			c.in.err = errRecord
+			return errRecord
+		}
+		c.inEOF = true
+	default:
+		c.in.err = errRecord
+		return errRecord
+	}
+	if err = c.in.ratchet(len(plaintext), c.rekeyAfter); err != nil {
+		c.in.err = err
+		return err
+	}
+	return nil
+}
+
+// Close sends a close record to the peer and closes
+// the underlying connection. If a Write is in progress,
+// Close does not send a close record but closes the
+// underlying connection right away such that the
+// pending Write returns.
+//
+// Close gives up sending the close record once the write
+// deadline expires - or after 5 seconds if no earlier write
+// deadline is set.
+func (c *Conn) Close() error {
+	if !c.out.TryLock() {
+		return c.conn.Close()
+	}
+	if c.out.err == nil {
+		// Do not block forever if the peer does not read.
+		deadline := time.Now().Add(closeTimeout)
+		c.deadlineLock.Lock()
+		if !c.writeDeadline.IsZero() && c.writeDeadline.Before(deadline) {
+			deadline = c.writeDeadline
+		}
+		c.deadlineLock.Unlock()
+		c.conn.SetWriteDeadline(deadline)
+		c.writeRecord(recordClose, nil)
+		c.out.err = net.ErrClosed
+	}
+	c.out.Unlock()
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines of the
+// underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	if err := c.conn.SetDeadline(t); err != nil {
+		return err
+	}
+	c.writeDeadline = t
+	return nil
+}
+
+// SetReadDeadline sets the read deadline of the underlying
+// connection.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the write deadline of the underlying
+// connection. A Write that times out may leave the connection
+// in a broken state.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	if err := c.conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	c.writeDeadline = t
+	return nil
+}
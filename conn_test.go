@@ -0,0 +1,231 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConn(t *testing.T) {
+	for _, rekeyAfter := range []uint64{0, 1000} {
+		key := make([]byte, 32)
+		c1, c2 := net.Pipe()
+		config := &ConnConfig{RekeyAfter: rekeyAfter}
+		client, err := ClientWithConfig(c1, key, config)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		server, err := ServerWithConfig(c2, key, config)
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+
+		data := make([]byte, 3*MaxRecordSize+123)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		errc := make(chan error, 1)
+		go func() {
+			if _, err := client.Write(data); err != nil {
+				errc <- err
+				return
+			}
+			if _, err := client.Write(data[:10]); err != nil {
+				errc <- err
+				return
+			}
+			errc <- client.Close()
+		}()
+
+		received, err := ioutil.ReadAll(server)
+		if err != nil {
+			t.Fatalf("RekeyAfter %d: Read failed: %v", rekeyAfter, err)
+		}
+		if err = <-errc; err != nil {
+			t.Fatalf("RekeyAfter %d: Write failed: %v", rekeyAfter, err)
+		}
+		if !bytes.Equal(received, append(data, data[:10]...)) {
+			t.Fatalf("RekeyAfter %d: data mismatch", rekeyAfter)
+		}
+		server.Close()
+	}
+}
+
+func TestConnDirections(t *testing.T) {
+	key := make([]byte, 16)
+	c1, c2 := net.Pipe()
+	client, _ := Client(c1, key)
+	server, _ := Server(c2, key)
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			return
+		}
+		server.Write(bytes.ToUpper(buf))
+		ioutil.ReadAll(server)
+	}()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buf) != "HELLO" {
+		t.Fatalf("got %q - want %q", buf, "HELLO")
+	}
+}
+
+// recordConn is a net.Conn writing to and reading from
+// a buffer.
+type recordConn struct {
+	net.Conn
+	bytes.Buffer
+}
+
+func (c *recordConn) Read(b []byte) (int, error)  { return c.Buffer.Read(b) }
+func (c *recordConn) Write(b []byte) (int, error) { return c.Buffer.Write(b) }
+func (c *recordConn) Close() error                { return nil }
+
+func (c *recordConn) SetWriteDeadline(time.Time) error { return nil }
+
+// splitRecords splits the raw connection data into records.
+func splitRecords(data []byte) (records [][]byte) {
+	for len(data) > 0 {
+		n := recordHeaderSize + int(binary.BigEndian.Uint16(data[1:]))
+		records = append(records, data[:n])
+		data = data[n:]
+	}
+	return records
+}
+
+func TestConnTampering(t *testing.T) {
+	key := make([]byte, 32)
+	raw := new(recordConn)
+	client, _ := Client(raw, key)
+	for _, msg := range []string{"first", "second", "third"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	client.Close()
+	records := splitRecords(raw.Bytes())
+	if len(records) != 4 {
+		t.Fatalf("got %d records - want 4", len(records))
+	}
+
+	tests := map[string][][]byte{
+		"replay":    {records[0], records[0], records[1], records[2], records[3]},
+		"reorder":   {records[1], records[0], records[2], records[3]},
+		"drop":      {records[0], records[2], records[3]},
+		"truncate":  {records[0], records[1], records[2]},
+		"partial":   {records[0], records[1], records[2], records[3][:4]},
+		"modified":  {records[0], append([]byte{recordClose}, records[1][1:]...), records[2], records[3]},
+		"untouched": {records[0], records[1], records[2], records[3]},
+	}
+	for name, test := range tests {
+		server, _ := Server(&recordConn{Buffer: *bytes.NewBuffer(bytes.Join(test, nil))}, key)
+		data, err := ioutil.ReadAll(server)
+		if name == "untouched" {
+			if err != nil || string(data) != "firstsecondthird" {
+				t.Fatalf("%s: got %q, %v", name, data, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: Read succeeded: %q", name, data)
+		}
+	}
+}
+
+func TestConnCloseDuringWrite(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	client, err := Client(c1, make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Write([]byte("nobody reads this"))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // Wait for the Write to block
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by pending Write")
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Write succeeded on closed connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock pending Write")
+	}
+}
+
+func TestConnCloseDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	client, err := Client(c1, make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Nobody reads the close record. Hence, Close must
+	// give up once the write deadline expires instead of
+	// replacing it with its own, later deadline.
+	if err = client.SetWriteDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("Failed to set write deadline: %v", err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close ignored the write deadline")
+	}
+}
+
+func TestConnError(t *testing.T) {
+	defer func() { backendErr = nil }()
+	backendErr = errUnknownBackend
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if _, err := Client(c1, make([]byte, 32)); err != errUnknownBackend {
+		t.Fatalf("Client: got error %v - want %v", err, errUnknownBackend)
+	}
+	backendErr = nil
+
+	// A failing key ratchet must break the connection.
+	client, err := ClientWithConfig(new(recordConn), make([]byte, 32), &ConnConfig{RekeyAfter: 1})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	backendErr = errUnknownBackend
+	if _, err = client.Write([]byte("ratchet")); err != errUnknownBackend {
+		t.Fatalf("Write: got error %v - want %v", err, errUnknownBackend)
+	}
+	if _, err = client.Write([]byte("ratchet")); err != errUnknownBackend {
+		t.Fatalf("Write after failed ratchet: got error %v - want %v", err, errUnknownBackend)
+	}
+}
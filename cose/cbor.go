@@ -0,0 +1,259 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package cose
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// CBOR major types as specified in RFC 8949 Section 3.1.
+const (
+	majorUint   byte = 0
+	majorNegInt byte = 1
+	majorBytes  byte = 2
+	majorText   byte = 3
+	majorArray  byte = 4
+	majorMap    byte = 5
+	majorTag    byte = 6
+	majorSimple byte = 7
+)
+
+const (
+	simpleFalse byte = 20
+	simpleTrue  byte = 21
+	simpleNull  byte = 22
+)
+
+// maxDepth limits the nesting of decoded CBOR data items.
+const maxDepth = 16
+
+var errCBOR = errors.New("cose: malformed CBOR")
+
+// null is the decoded CBOR null value.
+type null struct{}
+
+// tagged is a decoded CBOR tag and its content.
+type tagged struct {
+	tag     uint64
+	content interface{}
+}
+
+// appendHead appends the head of a CBOR data item using the
+// shortest possible encoding of the argument as required by the
+// core deterministic encoding (RFC 8949 Section 4.2.1).
+func appendHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		b = append(b, major|25, 0, 0)
+		binary.BigEndian.PutUint16(b[len(b)-2:], uint16(arg))
+		return b
+	case arg <= math.MaxUint32:
+		b = append(b, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(arg))
+		return b
+	default:
+		b = append(b, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], arg)
+		return b
+	}
+}
+
+// appendValue appends the deterministic CBOR encoding of v. It
+// supports int, int64, uint64, []byte, string, bool, null, tagged,
+// []interface{} and map[interface{}]interface{} values.
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		return appendValue(b, int64(v))
+	case int64:
+		if v < 0 {
+			return appendHead(b, majorNegInt, uint64(-(v + 1)))
+		}
+		return appendHead(b, majorUint, uint64(v))
+	case uint64:
+		return appendHead(b, majorUint, v)
+	case []byte:
+		return append(appendHead(b, majorBytes, uint64(len(v))), v...)
+	case string:
+		return append(appendHead(b, majorText, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return append(b, majorSimple<<5|simpleTrue)
+		}
+		return append(b, majorSimple<<5|simpleFalse)
+	case null:
+		return append(b, majorSimple<<5|simpleNull)
+	case tagged:
+		return appendValue(appendHead(b, majorTag, v.tag), v.content)
+	case []interface{}:
+		b = appendHead(b, majorArray, uint64(len(v)))
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	case map[interface{}]interface{}:
+		// Deterministic encoding requires the map keys to be
+		// sorted by the bytewise order of their encodings.
+		entries := make([][2][]byte, 0, len(v))
+		for key, value := range v {
+			entries = append(entries, [2][]byte{appendValue(nil, key), appendValue(nil, value)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i][0], entries[j][0]) < 0 })
+
+		b = appendHead(b, majorMap, uint64(len(v)))
+		for _, e := range entries {
+			b = append(append(b, e[0]...), e[1]...)
+		}
+		return b
+	default:
+		panic("cose: unsupported CBOR value")
+	}
+}
+
+// decode decodes exactly one CBOR data item from data.
+// Integers are decoded as int64, maps as
+// map[interface{}]interface{} and arrays as []interface{}.
+// It rejects indefinite-length items, integers that do
+// not fit into an int64, duplicate map keys and trailing
+// bytes.
+func decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.data) != 0 {
+		return nil, errCBOR
+	}
+	return v, nil
+}
+
+type decoder struct{ data []byte }
+
+func (d *decoder) head() (major byte, arg uint64, err error) {
+	if len(d.data) == 0 {
+		return 0, 0, errCBOR
+	}
+	major, info := d.data[0]>>5, d.data[0]&0x1f
+	d.data = d.data[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default: // reserved or indefinite length
+		return 0, 0, errCBOR
+	}
+	if len(d.data) < n {
+		return 0, 0, errCBOR
+	}
+	for _, c := range d.data[:n] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.data = d.data[n:]
+	return major, arg, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errCBOR
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case majorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case majorBytes, majorText:
+		if arg > uint64(len(d.data)) {
+			return nil, errCBOR
+		}
+		v := d.data[:arg]
+		d.data = d.data[arg:]
+		if major == majorText {
+			return string(v), nil
+		}
+		return append([]byte{}, v...), nil
+	case majorArray:
+		if arg > uint64(len(d.data)) { // every item takes at least one byte
+			return nil, errCBOR
+		}
+		a := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case majorMap:
+		if arg > uint64(len(d.data)) {
+			return nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+			if _, ok := m[key]; ok {
+				return nil, errCBOR
+			}
+			if m[key], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return tagged{tag: arg, content: v}, nil
+	default:
+		switch arg {
+		case uint64(simpleFalse):
+			return false, nil
+		case uint64(simpleTrue):
+			return true, nil
+		case uint64(simpleNull):
+			return null{}, nil
+		default:
+			return nil, errCBOR
+		}
+	}
+}
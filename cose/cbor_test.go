@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package cose
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// cborTests contains examples of RFC 8949 Appendix A.
+var cborTests = []struct {
+	value   interface{}
+	encoded string
+}{
+	{value: int64(0), encoded: "00"},
+	{value: int64(23), encoded: "17"},
+	{value: int64(24), encoded: "1818"},
+	{value: int64(100), encoded: "1864"},
+	{value: int64(1000), encoded: "1903e8"},
+	{value: int64(1000000), encoded: "1a000f4240"},
+	{value: int64(1000000000000), encoded: "1b000000e8d4a51000"},
+	{value: int64(-1), encoded: "20"},
+	{value: int64(-10), encoded: "29"},
+	{value: int64(-100), encoded: "3863"},
+	{value: int64(-1000), encoded: "3903e7"},
+	{value: false, encoded: "f4"},
+	{value: true, encoded: "f5"},
+	{value: null{}, encoded: "f6"},
+	{value: []byte{}, encoded: "40"},
+	{value: []byte{1, 2, 3, 4}, encoded: "4401020304"},
+	{value: "a", encoded: "6161"},
+	{value: "IETF", encoded: "6449455446"},
+	{value: []interface{}{int64(1), int64(2), int64(3)}, encoded: "83010203"},
+	{value: map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}, encoded: "a201020304"},
+	{value: tagged{tag: 1, content: int64(1363896240)}, encoded: "c11a514b67b0"},
+	{
+		// Keys are sorted by their encoding: 10, 100, -1, "z", "aa"
+		value: map[interface{}]interface{}{
+			"aa": int64(0), int64(-1): int64(0), "z": int64(0), int64(100): int64(0), int64(10): int64(0),
+		},
+		encoded: "a50a00186400200061 7a0062616100",
+	},
+}
+
+func TestCBOR(t *testing.T) {
+	for i, test := range cborTests {
+		encoded, _ := hex.DecodeString(removeSpaces(test.encoded))
+		if b := appendValue(nil, test.value); !bytes.Equal(b, encoded) {
+			t.Errorf("Test %d: encoding mismatch: got %x - want %x", i, b, encoded)
+		}
+		v, err := decode(encoded)
+		if err != nil {
+			t.Errorf("Test %d: decoding failed: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.value) {
+			t.Errorf("Test %d: decoded value mismatch: got %#v - want %#v", i, v, test.value)
+		}
+	}
+}
+
+var malformedCBORTests = []string{
+	"",                                       // empty
+	"18",                                     // missing argument
+	"5f4101ff",                               // indefinite-length byte string
+	"9f01ff",                                 // indefinite-length array
+	"a20102 0103",                            // duplicate map key
+	"4401",                                   // truncated byte string
+	"0000",                                   // trailing data
+	"1bffffffffffffffff",                     // integer overflows int64
+	"f93c00",                                 // float
+	"81818181818181818181818181818181818101", // nested too deeply
+}
+
+func TestMalformedCBOR(t *testing.T) {
+	for i, test := range malformedCBORTests {
+		data, _ := hex.DecodeString(removeSpaces(test))
+		if _, err := decode(data); err == nil {
+			t.Errorf("Test %d: decoded malformed CBOR %s", i, test)
+		}
+	}
+}
+
+func removeSpaces(s string) string { return string(bytes.Replace([]byte(s), []byte(" "), nil, -1)) }
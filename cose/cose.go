@@ -0,0 +1,402 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package cose implements COSE_Encrypt0 and COSE_Encrypt
+// messages as specified in RFC 9052 using the misuse-resistant
+// AEADs of the siv package.
+//
+// Neither AES-GCM-SIV nor AES-SIV-CMAC have COSE algorithm
+// identifiers registered with IANA. Therefore, this package
+// uses identifiers from the private-use range (less than
+// -65536). Messages produced by this package only interoperate
+// with implementations using the same identifiers. The "direct"
+// key distribution method uses its registered identifier -6.
+//
+// The package contains a small deterministic CBOR encoder and
+// does not depend on any module outside the standard library -
+// except the siv package itself.
+package cose
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// Algorithm is a COSE algorithm identifier.
+type Algorithm int64
+
+// Content encryption algorithms. These identifiers are from
+// the COSE private-use range and are NOT registered with IANA.
+const (
+	AES128GCMSIV Algorithm = -65537 // AES-GCM-SIV with a 16 byte key
+	AES256GCMSIV Algorithm = -65538 // AES-GCM-SIV with a 32 byte key
+	AESSIV256    Algorithm = -65539 // AES-SIV-CMAC with a 32 byte key
+	AESSIV384    Algorithm = -65540 // AES-SIV-CMAC with a 48 byte key
+	AESSIV512    Algorithm = -65541 // AES-SIV-CMAC with a 64 byte key
+)
+
+// Key distribution algorithms for COSE_Encrypt recipients.
+// The AES-SIV key wrap identifiers are from the COSE private-use
+// range and are NOT registered with IANA.
+const (
+	Direct      Algorithm = -6     // The recipient key is the CEK
+	AESSIVKW256 Algorithm = -65542 // AES-SIV key wrap with a 32 byte KEK
+	AESSIVKW384 Algorithm = -65543 // AES-SIV key wrap with a 48 byte KEK
+	AESSIVKW512 Algorithm = -65544 // AES-SIV key wrap with a 64 byte KEK
+)
+
+// COSE header labels and CBOR tags as specified in RFC 9052.
+const (
+	labelAlg  int64 = 1
+	labelCrit int64 = 2
+	labelKID  int64 = 4
+	labelIV   int64 = 5
+
+	tagEncrypt0 = 16
+	tagEncrypt  = 96
+)
+
+var (
+	errDecrypt   = errors.New("cose: decryption failed")
+	errMalformed = errors.New("cose: malformed COSE message")
+	errAlgorithm = errors.New("cose: unsupported algorithm")
+	errCritical  = errors.New("cose: unsupported critical header parameter")
+	errDuplicate = errors.New("cose: duplicate header parameter")
+	errKeySize   = errors.New("cose: invalid key size")
+	errDetached  = errors.New("cose: detached content is not supported")
+)
+
+// keySize returns the key size of a content encryption
+// or AES-SIV key wrap algorithm.
+func (a Algorithm) keySize() int {
+	switch a {
+	case AES128GCMSIV:
+		return 16
+	case AES256GCMSIV, AESSIV256, AESSIVKW256:
+		return 32
+	case AESSIV384, AESSIVKW384:
+		return 48
+	case AESSIV512, AESSIVKW512:
+		return 64
+	default:
+		return 0
+	}
+}
+
+func (a Algorithm) isContentEncryption() bool {
+	switch a {
+	case AES128GCMSIV, AES256GCMSIV, AESSIV256, AESSIV384, AESSIV512:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a Algorithm) newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != a.keySize() {
+		return nil, errKeySize
+	}
+	switch a {
+	case AES128GCMSIV, AES256GCMSIV:
+		return siv.NewGCM(key)
+	case AESSIV256, AESSIV384, AESSIV512, AESSIVKW256, AESSIVKW384, AESSIVKW512:
+		return siv.NewCMAC(key)
+	default:
+		return nil, errAlgorithm
+	}
+}
+
+// Recipient is a COSE_Encrypt recipient. The Algorithm must be
+// either Direct - the Key is the CEK - or one of the AES-SIV key
+// wrap algorithms - the Key is the KEK.
+type Recipient struct {
+	Algorithm Algorithm
+	Key       []byte
+	KeyID     []byte
+}
+
+// Encrypt0 encrypts and authenticates plaintext and externalAAD
+// with the key using the content encryption algorithm alg and
+// returns the tagged COSE_Encrypt0 message. If keyID is not empty
+// it is included as "kid" in the unprotected header.
+func Encrypt0(key []byte, alg Algorithm, keyID, plaintext, externalAAD []byte) ([]byte, error) {
+	protected, unprotected, ciphertext, err := encryptContent(key, alg, "Encrypt0", keyID, plaintext, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	return appendValue(nil, tagged{tag: tagEncrypt0, content: []interface{}{
+		protected, unprotected, ciphertext,
+	}}), nil
+}
+
+// Decrypt0 parses a (tagged or untagged) COSE_Encrypt0 message,
+// decrypts it with the key and returns the plaintext.
+func Decrypt0(key, message, externalAAD []byte) ([]byte, error) {
+	fields, err := parseMessage(message, tagEncrypt0, 3)
+	if err != nil {
+		return nil, err
+	}
+	return decryptContent(key, "Encrypt0", fields, externalAAD)
+}
+
+// Encrypt encrypts and authenticates plaintext and externalAAD with
+// a fresh content encryption key (CEK) using the content encryption
+// algorithm alg and returns the tagged COSE_Encrypt message. The CEK
+// is distributed to every recipient.
+//
+// A Direct recipient must be the only recipient and its key is used
+// as CEK.
+func Encrypt(recipients []Recipient, alg Algorithm, plaintext, externalAAD []byte) ([]byte, error) {
+	if len(recipients) == 0 || !alg.isContentEncryption() {
+		return nil, errAlgorithm
+	}
+
+	var cek []byte
+	if recipients[0].Algorithm == Direct {
+		if len(recipients) != 1 {
+			return nil, errors.New("cose: a direct recipient must be the only recipient")
+		}
+		cek = recipients[0].Key
+	} else {
+		cek = make([]byte, alg.keySize())
+		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded := make([]interface{}, 0, len(recipients))
+	for _, r := range recipients {
+		unprotected := map[interface{}]interface{}{labelAlg: int64(r.Algorithm)}
+		if len(r.KeyID) > 0 {
+			unprotected[labelKID] = r.KeyID
+		}
+		var encryptedKey []byte
+		switch r.Algorithm {
+		case Direct:
+			encryptedKey = []byte{}
+		case AESSIVKW256, AESSIVKW384, AESSIVKW512:
+			kw, err := r.Algorithm.newAEAD(r.Key)
+			if err != nil {
+				return nil, err
+			}
+			encryptedKey = kw.Seal(nil, nil, cek, nil)
+		default:
+			return nil, errAlgorithm
+		}
+		encoded = append(encoded, []interface{}{[]byte{}, unprotected, encryptedKey})
+	}
+
+	protected, unprotected, ciphertext, err := encryptContent(cek, alg, "Encrypt", nil, plaintext, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	return appendValue(nil, tagged{tag: tagEncrypt, content: []interface{}{
+		protected, unprotected, ciphertext, encoded,
+	}}), nil
+}
+
+// Decrypt parses a (tagged or untagged) COSE_Encrypt message,
+// obtains the CEK from the first recipient that can be processed
+// with the key and returns the decrypted plaintext.
+func Decrypt(key, message, externalAAD []byte) ([]byte, error) {
+	fields, err := parseMessage(message, tagEncrypt, 4)
+	if err != nil {
+		return nil, err
+	}
+	recipients, ok := fields[3].([]interface{})
+	if !ok || len(recipients) == 0 {
+		return nil, errMalformed
+	}
+	for _, r := range recipients {
+		recipient, ok := r.([]interface{})
+		if !ok || len(recipient) != 3 {
+			return nil, errMalformed
+		}
+		h, err := parseHeaders(recipient[0], recipient[1])
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, ok := recipient[2].([]byte)
+		if !ok {
+			return nil, errMalformed
+		}
+
+		var cek []byte
+		switch h.alg {
+		case Direct:
+			cek = key
+		case AESSIVKW256, AESSIVKW384, AESSIVKW512:
+			kw, err := h.alg.newAEAD(key)
+			if err != nil {
+				continue // The key does not match this recipient
+			}
+			if cek, err = kw.Open(nil, nil, encryptedKey, nil); err != nil {
+				continue
+			}
+		default:
+			return nil, errAlgorithm
+		}
+		plaintext, err := decryptContent(cek, "Encrypt", fields, externalAAD)
+		if err == errDecrypt || err == errKeySize {
+			continue
+		}
+		return plaintext, err
+	}
+	return nil, errDecrypt
+}
+
+// encryptContent generates a random IV and encrypts the plaintext
+// using the Enc_structure for the given context as additional data.
+func encryptContent(key []byte, alg Algorithm, context string, keyID, plaintext, externalAAD []byte) (protected []byte, unprotected map[interface{}]interface{}, ciphertext []byte, err error) {
+	if !alg.isContentEncryption() {
+		return nil, nil, nil, errAlgorithm
+	}
+	aead, err := alg.newAEAD(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, nil, err
+	}
+
+	protected = appendValue(nil, map[interface{}]interface{}{labelAlg: int64(alg)})
+	unprotected = map[interface{}]interface{}{labelIV: iv}
+	if len(keyID) > 0 {
+		unprotected[labelKID] = keyID
+	}
+	ciphertext = aead.Seal(nil, iv, plaintext, encStructure(context, protected, externalAAD))
+	return protected, unprotected, ciphertext, nil
+}
+
+func decryptContent(key []byte, context string, fields []interface{}, externalAAD []byte) ([]byte, error) {
+	h, err := parseHeaders(fields[0], fields[1])
+	if err != nil {
+		return nil, err
+	}
+	if !h.alg.isContentEncryption() || !h.algProtected {
+		return nil, errAlgorithm
+	}
+	if _, ok := fields[2].(null); ok {
+		return nil, errDetached
+	}
+	ciphertext, ok := fields[2].([]byte)
+	if !ok {
+		return nil, errMalformed
+	}
+	aead, err := h.alg.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.iv) != aead.NonceSize() {
+		return nil, errMalformed
+	}
+	plaintext, err := aead.Open(nil, h.iv, ciphertext, encStructure(context, h.protected, externalAAD))
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plaintext, nil
+}
+
+// encStructure returns the encoded Enc_structure as specified
+// by RFC 9052 Section 5.3.
+func encStructure(context string, protected, externalAAD []byte) []byte {
+	if externalAAD == nil {
+		externalAAD = []byte{}
+	}
+	return appendValue(nil, []interface{}{context, protected, externalAAD})
+}
+
+// parseMessage decodes a COSE message with n fields that is
+// either untagged or tagged with the given tag.
+func parseMessage(message []byte, tag uint64, n int) ([]interface{}, error) {
+	v, err := decode(message)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(tagged); ok {
+		if t.tag != tag {
+			return nil, errMalformed
+		}
+		v = t.content
+	}
+	fields, ok := v.([]interface{})
+	if !ok || len(fields) != n {
+		return nil, errMalformed
+	}
+	return fields, nil
+}
+
+type headers struct {
+	protected    []byte
+	alg          Algorithm
+	algProtected bool
+	iv           []byte
+}
+
+// parseHeaders parses the protected (a bstr wrapped map) and
+// unprotected header buckets. It rejects parameters present in
+// both buckets and any critical parameter since this package
+// does not understand any header extensions.
+func parseHeaders(protected, unprotected interface{}) (headers, error) {
+	var h headers
+	p, ok := protected.([]byte)
+	if !ok {
+		return h, errMalformed
+	}
+	h.protected = p
+
+	protectedMap := map[interface{}]interface{}{}
+	if len(p) > 0 {
+		v, err := decode(p)
+		if err != nil {
+			return h, err
+		}
+		if protectedMap, ok = v.(map[interface{}]interface{}); !ok {
+			return h, errMalformed
+		}
+	}
+	unprotectedMap, ok := unprotected.(map[interface{}]interface{})
+	if !ok {
+		return h, errMalformed
+	}
+	for label := range unprotectedMap {
+		if _, ok := protectedMap[label]; ok {
+			return h, errDuplicate
+		}
+	}
+	if _, ok := protectedMap[labelCrit]; ok {
+		return h, errCritical
+	}
+	if _, ok := unprotectedMap[labelCrit]; ok {
+		return h, errMalformed // crit must be protected
+	}
+
+	alg, ok := protectedMap[labelAlg]
+	if ok {
+		h.algProtected = true
+	} else if alg, ok = unprotectedMap[labelAlg]; !ok {
+		return h, errMalformed
+	}
+	id, ok := alg.(int64)
+	if !ok {
+		return h, errAlgorithm
+	}
+	h.alg = Algorithm(id)
+
+	if iv, ok := protectedMap[labelIV]; ok {
+		if h.iv, ok = iv.([]byte); !ok {
+			return h, errMalformed
+		}
+	} else if iv, ok := unprotectedMap[labelIV]; ok {
+		if h.iv, ok = iv.([]byte); !ok {
+			return h, errMalformed
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package cose
+
+import (
+	"bytes"
+	"testing"
+)
+
+var contentAlgorithms = []Algorithm{AES128GCMSIV, AES256GCMSIV, AESSIV256, AESSIV384, AESSIV512}
+
+func TestEncrypt0(t *testing.T) {
+	plaintext, externalAAD := []byte("This is the content."), []byte("external AAD")
+	for _, alg := range contentAlgorithms {
+		key := bytes.Repeat([]byte{0x42}, alg.keySize())
+		message, err := Encrypt0(key, alg, []byte("kid"), plaintext, externalAAD)
+		if err != nil {
+			t.Fatalf("Alg %d: Encrypt0 failed: %v", alg, err)
+		}
+		if message[0] != 0xd0 { // tag 16
+			t.Fatalf("Alg %d: message is not tagged as COSE_Encrypt0", alg)
+		}
+		p, err := Decrypt0(key, message, externalAAD)
+		if err != nil {
+			t.Fatalf("Alg %d: Decrypt0 failed: %v", alg, err)
+		}
+		if !bytes.Equal(p, plaintext) {
+			t.Fatalf("Alg %d: plaintext mismatch", alg)
+		}
+		if _, err = Decrypt0(key, message, nil); err != errDecrypt {
+			t.Fatalf("Alg %d: Decrypt0 with wrong external AAD: got %v - want %v", alg, err, errDecrypt)
+		}
+		if _, err = Decrypt(key, message, externalAAD); err == nil {
+			t.Fatalf("Alg %d: COSE_Encrypt0 accepted as COSE_Encrypt", alg)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	plaintext, externalAAD := []byte("This is the content."), []byte("external AAD")
+	recipients := []Recipient{
+		{Algorithm: AESSIVKW256, Key: bytes.Repeat([]byte{1}, 32), KeyID: []byte("alice")},
+		{Algorithm: AESSIVKW512, Key: bytes.Repeat([]byte{2}, 64), KeyID: []byte("bob")},
+	}
+	for _, alg := range contentAlgorithms {
+		message, err := Encrypt(recipients, alg, plaintext, externalAAD)
+		if err != nil {
+			t.Fatalf("Alg %d: Encrypt failed: %v", alg, err)
+		}
+		for _, r := range recipients {
+			p, err := Decrypt(r.Key, message, externalAAD)
+			if err != nil {
+				t.Fatalf("Alg %d/%s: Decrypt failed: %v", alg, r.KeyID, err)
+			}
+			if !bytes.Equal(p, plaintext) {
+				t.Fatalf("Alg %d/%s: plaintext mismatch", alg, r.KeyID)
+			}
+		}
+		if _, err = Decrypt(bytes.Repeat([]byte{3}, 32), message, externalAAD); err != errDecrypt {
+			t.Fatalf("Alg %d: Decrypt with unknown key: got %v - want %v", alg, err, errDecrypt)
+		}
+
+		key := bytes.Repeat([]byte{4}, alg.keySize())
+		message, err = Encrypt([]Recipient{{Algorithm: Direct, Key: key}}, alg, plaintext, nil)
+		if err != nil {
+			t.Fatalf("Alg %d: Encrypt with direct recipient failed: %v", alg, err)
+		}
+		if p, err := Decrypt(key, message, nil); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("Alg %d: Decrypt with direct recipient failed: %v", alg, err)
+		}
+	}
+}
+
+func TestEncrypt0Strict(t *testing.T) {
+	key := make([]byte, 16)
+	message, err := Encrypt0(key, AES128GCMSIV, nil, []byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt0 failed: %v", err)
+	}
+	v, _ := decode(message)
+	fields := v.(tagged).content.([]interface{})
+
+	critical := append([]interface{}(nil), fields...)
+	critical[0] = appendValue(nil, map[interface{}]interface{}{labelAlg: int64(AES128GCMSIV), labelCrit: []interface{}{int64(-70000)}, int64(-70000): true})
+	if _, err = Decrypt0(key, appendValue(nil, critical), nil); err != errCritical {
+		t.Fatalf("got error %v - want %v", err, errCritical)
+	}
+
+	duplicate := append([]interface{}(nil), fields...)
+	duplicate[1] = map[interface{}]interface{}{labelAlg: int64(AES128GCMSIV), labelIV: fields[1].(map[interface{}]interface{})[labelIV]}
+	if _, err = Decrypt0(key, appendValue(nil, duplicate), nil); err != errDuplicate {
+		t.Fatalf("got error %v - want %v", err, errDuplicate)
+	}
+
+	detached := append([]interface{}(nil), fields...)
+	detached[2] = null{}
+	if _, err = Decrypt0(key, appendValue(nil, detached), nil); err != errDetached {
+		t.Fatalf("got error %v - want %v", err, errDetached)
+	}
+
+	if _, err = Decrypt0(key, appendValue(nil, tagged{tag: tagEncrypt, content: fields}), nil); err != errMalformed {
+		t.Fatalf("got error %v - want %v", err, errMalformed)
+	}
+	if _, err = Decrypt0(key, appendValue(nil, fields), nil); err != nil {
+		t.Fatalf("Decrypt0 of untagged message failed: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+// ErrDestroyed is returned by Open - and the value Seal panics
+// with - when the AEAD has been destroyed.
+var ErrDestroyed = errors.New("siv: AEAD has been destroyed")
+
+// Destroyer is implemented by the AEADs returned by NewCMAC,
+// NewCMACFromBlocks, NewGCM, NewGCMSIVFromBlock and
+// NewExtendedGCM.
+//
+// Destroy overwrites the key material owned by the AEAD - the
+// raw keys, the AES key schedules of all backends and the derived
+// subkeys - with zeros. Afterwards, Open returns ErrDestroyed.
+// Seal panics with ErrDestroyed since its signature provides no
+// way to return an error. Destroy must not be called concurrently
+// with Seal or Open.
+//
+// The block ciphers passed to NewCMACFromBlocks or returned by the
+// newBlock function of NewGCMSIVFromBlock are owned by the caller.
+// They are destroyed if they implement Destroyer themselves. Hence,
+// the key schedules of block ciphers returned by aes.NewCipher are
+// not wiped.
+type Destroyer interface {
+	Destroy()
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeBlock destroys the block cipher if it implements
+// Destroyer. Otherwise, it does nothing.
+func wipeBlock(block cipher.Block) {
+	if d, ok := block.(Destroyer); ok {
+		d.Destroy()
+	}
+}
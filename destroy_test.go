@@ -0,0 +1,92 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestDestroy(t *testing.T) { testBackends(t, testDestroy) }
+
+func testDestroy(t *testing.T) {
+	newExtendedGCM := func(key []byte) (cipher.AEAD, error) { return NewExtendedGCM(key, 32) }
+	newCMACFromBlocks := func(key []byte) (cipher.AEAD, error) {
+		macBlock, _ := aes.NewCipher(key[:16])
+		ctrBlock, _ := aes.NewCipher(key[16:])
+		return NewCMACFromBlocks(macBlock, ctrBlock)
+	}
+	newGCMSIVFromBlock := func(key []byte) (cipher.AEAD, error) { return NewGCMSIVFromBlock(aes.NewCipher, key) }
+
+	for i, newAEAD := range []func([]byte) (cipher.AEAD, error){NewCMAC, NewGCM, newExtendedGCM, newCMACFromBlocks, newGCMSIVFromBlock} {
+		c, err := newAEAD(make([]byte, 32))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create AEAD: %v", i, err)
+		}
+		nonce := make([]byte, c.NonceSize())
+		ciphertext := c.Seal(nil, nonce, []byte("plaintext"), nil)
+
+		c.(Destroyer).Destroy()
+		c.(Destroyer).Destroy() // Destroy must be idempotent
+
+		mustPanic := func(name string, f func()) {
+			defer func() {
+				if err := recover(); err != ErrDestroyed {
+					t.Fatalf("Test %d: %s: got panic %v - want %v", i, name, err, ErrDestroyed)
+				}
+			}()
+			f()
+		}
+		mustPanic("Seal", func() { c.Seal(nil, nonce, []byte("plaintext"), nil) })
+		if _, err = c.Open(nil, nonce, ciphertext, nil); err != ErrDestroyed {
+			t.Fatalf("Test %d: Open: got error %v - want %v", i, err, ErrDestroyed)
+		}
+	}
+}
+
+func TestDestroyWipesKeys(t *testing.T) {
+	macBlock, _ := aes.NewCipher(make([]byte, 16))
+	ctrBlock, _ := aes.NewCipher(make([]byte, 16))
+	c, _ := NewCMACFromBlocks(macBlock, ctrBlock)
+	subkeys := c.(*aesSivCMac).aead.(*aesSivCMacGeneric).mem.data
+	c.(Destroyer).Destroy()
+
+	if !bytes.Equal(subkeys, make([]byte, len(subkeys))) {
+		t.Fatal("CMAC subkeys have not been wiped")
+	}
+}
+
+func TestDestroyWipesKeySchedules(t *testing.T) { testBackends(t, testDestroyWipesKeySchedules) }
+
+func testDestroyWipesKeySchedules(t *testing.T) {
+	isZero := func(b []byte) bool { return bytes.Equal(b, make([]byte, len(b))) }
+
+	cmac, _ := NewCMAC(make([]byte, 32))
+	if c, ok := cmac.(*aesSivCMac).aead.(*aesSivCMacGeneric); ok {
+		keys := c.mem.data
+		cmac.(Destroyer).Destroy()
+		if !isZero(keys) {
+			t.Fatal("AES-SIV-CMAC key schedules have not been wiped")
+		}
+	}
+
+	gcm, _ := NewGCM(make([]byte, 32))
+	if c, ok := gcm.(*aesGcmSiv).aead.(*aesGcmSivGeneric); ok {
+		keys := c.mem.data
+		gcm.(Destroyer).Destroy()
+		if !isZero(keys) {
+			t.Fatal("AES-GCM-SIV key schedule has not been wiped")
+		}
+	}
+
+	ext, _ := NewExtendedGCM(make([]byte, 32), 24)
+	keys := ext.(*aesGcmSivExt).block.(*aesGenericOwned).keys
+	ext.(Destroyer).Destroy()
+	if !isZero(keys) {
+		t.Fatal("Extended AES-GCM-SIV key schedule has not been wiped")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	envelopeMagic   = 0xA5
+	envelopeVersion = 1
+)
+
+var (
+	errEnvelope       = errors.New("siv: invalid envelope")
+	errEnvelopeKey    = errors.New("siv: envelope algorithm or key ID does not match key")
+	errEnvelopePolicy = errors.New("siv: envelope algorithm not allowed by policy")
+	errEnvelopeNoKey  = errors.New("siv: no key found for envelope")
+)
+
+// Envelope is a self-describing ciphertext. Its encoding is:
+//
+//	magic 0xA5 (1 byte) || version (1 byte) || algorithm (1 byte) ||
+//	key ID (4 bytes, big-endian) || nonce || ciphertext
+//
+// The nonce is 12 bytes long for AES-GCM-SIV and 16 bytes long
+// for AES-SIV-CMAC. The header - all bytes preceding the
+// ciphertext - is prepended to the additional data. Therefore,
+// modifying the header causes decryption to fail.
+type Envelope struct {
+	Version    byte
+	Algorithm  Algorithm
+	KeyID      uint32
+	Nonce      []byte
+	Ciphertext []byte
+
+	header []byte
+}
+
+// EnvelopePolicy restricts the envelopes accepted by
+// ParseEnvelope and OpenEnvelope.
+type EnvelopePolicy struct {
+	// Algorithms are the accepted algorithms. If empty,
+	// all algorithms are accepted.
+	Algorithms []Algorithm
+}
+
+func (p *EnvelopePolicy) allows(alg Algorithm) bool {
+	if p == nil || len(p.Algorithms) == 0 {
+		return true
+	}
+	for _, a := range p.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// SealEnvelope encrypts and authenticates the plaintext and the
+// additional data with the key under a random nonce and returns
+// the encoded envelope.
+func SealEnvelope(key *Key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := key.AEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := aead.NonceSize()
+	header := make([]byte, 7+nonceSize, 7+nonceSize+len(plaintext)+aead.Overhead())
+	header[0], header[1], header[2] = envelopeMagic, envelopeVersion, byte(key.Algorithm())
+	binary.BigEndian.PutUint32(header[3:], key.ID())
+	if _, err = io.ReadFull(rand.Reader, header[7:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, header[7:], plaintext, envelopeAD(header, additionalData)), nil
+}
+
+// ParseEnvelope decodes an envelope. It returns an error if the
+// envelope is malformed or if its algorithm is not allowed by the
+// policy. A nil policy accepts all algorithms.
+func ParseEnvelope(data []byte, policy *EnvelopePolicy) (*Envelope, error) {
+	if len(data) < 7 || data[0] != envelopeMagic {
+		return nil, errEnvelope
+	}
+	if data[1] != envelopeVersion {
+		return nil, fmt.Errorf("siv: unsupported envelope version %d", data[1])
+	}
+	alg := Algorithm(data[2])
+	nonceSize := alg.NonceSize()
+	if nonceSize == 0 {
+		return nil, errUnknownAlgorithm
+	}
+	if !policy.allows(alg) {
+		return nil, errEnvelopePolicy
+	}
+	if len(data) < 7+nonceSize+16 {
+		return nil, errEnvelope
+	}
+	return &Envelope{
+		Version:    data[1],
+		Algorithm:  alg,
+		KeyID:      binary.BigEndian.Uint32(data[3:]),
+		Nonce:      data[7 : 7+nonceSize],
+		Ciphertext: data[7+nonceSize:],
+		header:     data[:7+nonceSize],
+	}, nil
+}
+
+// OpenEnvelope parses the envelope, looks up its key by ID and
+// decrypts and authenticates it. It rejects envelopes whose
+// algorithm is not allowed by the policy or differs from the
+// algorithm of the key. A nil policy accepts all algorithms.
+// The lookup function may return a nil key and a nil error if
+// no key with the ID exists.
+func OpenEnvelope(data, additionalData []byte, policy *EnvelopePolicy, lookup func(keyID uint32) (*Key, error)) ([]byte, error) {
+	envelope, err := ParseEnvelope(data, policy)
+	if err != nil {
+		return nil, err
+	}
+	key, err := lookup(envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errEnvelopeNoKey
+	}
+	if key.Algorithm() != envelope.Algorithm || key.ID() != envelope.KeyID {
+		return nil, errEnvelopeKey
+	}
+	aead, err := key.AEAD()
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, envelope.Nonce, envelope.Ciphertext, envelopeAD(envelope.header, additionalData))
+}
+
+func envelopeAD(header, additionalData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(additionalData))
+	ad = append(ad, header...)
+	return append(ad, additionalData...)
+}
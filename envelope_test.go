@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func keyLookup(keys ...*Key) func(uint32) (*Key, error) {
+	return func(id uint32) (*Key, error) {
+		for _, key := range keys {
+			if key.ID() == id {
+				return key, nil
+			}
+		}
+		return nil, errors.New("key not found")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	plaintext, ad := []byte("envelope plaintext"), []byte("envelope ad")
+	for i, alg := range keyAlgorithms {
+		key, _ := GenerateKey(alg)
+		data, err := SealEnvelope(key, plaintext, ad)
+		if err != nil {
+			t.Fatalf("Test %d: SealEnvelope failed: %v", i, err)
+		}
+		envelope, err := ParseEnvelope(data, nil)
+		if err != nil {
+			t.Fatalf("Test %d: ParseEnvelope failed: %v", i, err)
+		}
+		if envelope.Algorithm != alg || envelope.KeyID != key.ID() || envelope.Version != envelopeVersion {
+			t.Fatalf("Test %d: header mismatch: %+v", i, envelope)
+		}
+		p, err := OpenEnvelope(data, ad, &EnvelopePolicy{Algorithms: []Algorithm{alg}}, keyLookup(key))
+		if err != nil {
+			t.Fatalf("Test %d: OpenEnvelope failed: %v", i, err)
+		}
+		if !bytes.Equal(p, plaintext) {
+			t.Fatalf("Test %d: plaintext mismatch", i)
+		}
+
+		for j := range data {
+			modified := append([]byte{}, data...)
+			modified[j] ^= 1
+			if _, err = OpenEnvelope(modified, ad, nil, keyLookup(key)); err == nil {
+				t.Fatalf("Test %d: OpenEnvelope succeeded for modified byte %d", i, j)
+			}
+		}
+		if _, err = OpenEnvelope(data, nil, nil, keyLookup(key)); err == nil {
+			t.Fatalf("Test %d: OpenEnvelope succeeded for wrong AD", i)
+		}
+	}
+}
+
+func TestEnvelopeDowngrade(t *testing.T) {
+	weak, _ := GenerateKey(AES128GCMSIV)
+	strong, _ := GenerateKey(AES256GCMSIV)
+	policy := &EnvelopePolicy{Algorithms: []Algorithm{AES256GCMSIV, AES256SIV}}
+	lookup := keyLookup(weak, strong)
+
+	data, _ := SealEnvelope(weak, []byte("secret"), nil)
+	if _, err := OpenEnvelope(data, nil, policy, lookup); err != errEnvelopePolicy {
+		t.Fatalf("OpenEnvelope: got %v - want %v", err, errEnvelopePolicy)
+	}
+	if _, err := ParseEnvelope(data, policy); err != errEnvelopePolicy {
+		t.Fatalf("ParseEnvelope: got %v - want %v", err, errEnvelopePolicy)
+	}
+
+	// A header claiming another algorithm than the one of the key
+	// must be rejected - even if both algorithms use 32 byte keys.
+	data, _ = SealEnvelope(strong, []byte("secret"), nil)
+	data[2] = byte(AES128SIV)
+	data = append(data, make([]byte, 4)...) // AES-SIV-CMAC uses 16 byte nonces
+	if _, err := OpenEnvelope(data, nil, nil, lookup); err != errEnvelopeKey {
+		t.Fatalf("OpenEnvelope: got %v - want %v", err, errEnvelopeKey)
+	}
+
+	noKey := func(uint32) (*Key, error) { return nil, nil }
+	if _, err := OpenEnvelope(data, nil, nil, noKey); err != errEnvelopeNoKey {
+		t.Fatalf("OpenEnvelope: got %v - want %v", err, errEnvelopeNoKey)
+	}
+
+	for i, data := range [][]byte{nil, {envelopeMagic}, {0, envelopeVersion, 1, 0, 0, 0, 0}, {envelopeMagic, 2, 1, 0, 0, 0, 0}, {envelopeMagic, envelopeVersion, 1, 0, 0, 0, 0}} {
+		if _, err := ParseEnvelope(data, nil); err == nil {
+			t.Fatalf("Test %d: ParseEnvelope accepted malformed envelope", i)
+		}
+	}
+}
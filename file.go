@@ -0,0 +1,338 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultBlockSize is the recommended block size
+// of an encrypted File.
+const DefaultBlockSize = 4096
+
+const (
+	fileHeaderSize = 28
+	fileNonceSize  = 12
+	fileTagSize    = 16
+	fileOverhead   = fileNonceSize + fileTagSize
+	fileVersion    = 1
+	maxBlockSize   = 1 << 24
+)
+
+var fileMagic = [4]byte{'S', 'I', 'V', 'F'}
+
+var (
+	errFileFormat    = errors.New("siv: invalid encrypted file format")
+	errFileBlockSize = errors.New("siv: invalid block size for encrypted file")
+	errFileOffset    = errors.New("siv: negative offset")
+)
+
+// File is an encrypted file supporting random access.
+//
+// A File splits its content into fixed-size blocks. Each block
+// is sealed with AES-GCM-SIV under a random nonce and stored as:
+//
+//	nonce (12 bytes) || ciphertext (up to block size bytes) || tag (16 bytes)
+//
+// The blocks follow a 28 byte header:
+//
+//	magic "SIVF" (4 bytes) || version (1 byte) || reserved (3 bytes) ||
+//	block size (4 bytes, big-endian) || file ID (16 bytes, random)
+//
+// The additional data of a block is the header, the block index
+// (8 bytes, big-endian) and a flag (1 byte) marking the final
+// block. Hence, blocks cannot be moved within a file or between
+// files and truncating a file at a block boundary is detected.
+// A File always contains at least one - possibly empty - block.
+//
+// Due to the SIV property, rewriting a block - even under a
+// repeated nonce - only reveals whether the block content
+// has changed.
+//
+// A File is safe for concurrent use by multiple goroutines.
+type File struct {
+	mu        sync.Mutex
+	f         *os.File
+	aead      cipher.AEAD
+	header    [fileHeaderSize]byte
+	blockSize int64
+	size      int64 // plaintext size
+}
+
+// NewFile initializes the empty file f as encrypted file using
+// the given block size and returns it. The key must be either 16
+// or 32 bytes long.
+func NewFile(f *os.File, key []byte, blockSize int) (*File, error) {
+	if blockSize <= 0 || blockSize > maxBlockSize {
+		return nil, errFileBlockSize
+	}
+	aead, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil {
+		return nil, err
+	} else if fi.Size() != 0 {
+		return nil, errors.New("siv: file is not empty")
+	}
+
+	file := &File{f: f, aead: aead, blockSize: int64(blockSize)}
+	copy(file.header[:], fileMagic[:])
+	file.header[4] = fileVersion
+	binary.BigEndian.PutUint32(file.header[8:], uint32(blockSize))
+	if _, err = io.ReadFull(rand.Reader, file.header[12:]); err != nil {
+		return nil, err
+	}
+	if _, err = f.WriteAt(file.header[:], 0); err != nil {
+		return nil, err
+	}
+	if err = file.writeBlock(0, nil, true); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// OpenFile opens the encrypted file f using the given key. The
+// key must be either 16 or 32 bytes long. OpenFile verifies the
+// final block of the file.
+func OpenFile(f *os.File, key []byte) (*File, error) {
+	aead, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{f: f, aead: aead}
+	if _, err = f.ReadAt(file.header[:], 0); err != nil {
+		if err == io.EOF {
+			err = errFileFormat
+		}
+		return nil, err
+	}
+	if !bytes.Equal(file.header[:4], fileMagic[:]) || file.header[4] != fileVersion {
+		return nil, errFileFormat
+	}
+	file.blockSize = int64(binary.BigEndian.Uint32(file.header[8:]))
+	if file.blockSize == 0 || file.blockSize > maxBlockSize {
+		return nil, errFileFormat
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	body := fi.Size() - fileHeaderSize
+	if body < fileOverhead {
+		return nil, errFileFormat
+	}
+	last := (body - 1) / (file.blockSize + fileOverhead)
+	lastLen := body - last*(file.blockSize+fileOverhead) - fileOverhead
+	if lastLen < 0 {
+		return nil, errFileFormat
+	}
+	file.size = last*file.blockSize + lastLen
+
+	if _, err = file.readBlock(last, true); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Size returns the size of the decrypted content.
+func (f *File) Size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// ReadAt reads len(p) decrypted bytes starting at offset off.
+// It returns an error if any block cannot be authenticated.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errFileOffset
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	for n < len(p) && off < f.size {
+		i := off / f.blockSize
+		block, err := f.readBlock(i, i == f.lastBlock())
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], block[off-i*f.blockSize:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt encrypts and writes len(p) bytes starting at offset
+// off. If off is larger than the current size, the gap is
+// filled with zeros.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errFileOffset
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.write(p, off); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Truncate changes the size of the decrypted content. If
+// size is larger than the current size, the file is extended
+// with zeros.
+func (f *File) Truncate(size int64) error {
+	if size < 0 {
+		return errFileOffset
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if size >= f.size {
+		return f.write(nil, size)
+	}
+
+	last := int64(0)
+	if size > 0 {
+		last = (size - 1) / f.blockSize
+	}
+	block, err := f.readBlock(last, last == f.lastBlock())
+	if err != nil {
+		return err
+	}
+	block = block[:size-last*f.blockSize]
+	if err = f.writeBlock(last, block, true); err != nil {
+		return err
+	}
+	if err = f.f.Truncate(f.blockOffset(last) + fileOverhead + int64(len(block))); err != nil {
+		return err
+	}
+	f.size = size
+	return nil
+}
+
+// Sync commits the underlying file to stable storage.
+func (f *File) Sync() error { return f.f.Sync() }
+
+// Close closes the underlying file.
+func (f *File) Close() error { return f.f.Close() }
+
+// write writes p at offset off and extends the file
+// with zeros if necessary. The caller must hold f.mu.
+func (f *File) write(p []byte, off int64) error {
+	end := off + int64(len(p))
+	if len(p) == 0 && end <= f.size {
+		return nil
+	}
+	size := f.size
+	if end > size {
+		size = end
+	}
+	oldLast := f.lastBlock()
+	newLast := int64(0)
+	if size > 0 {
+		newLast = (size - 1) / f.blockSize
+	}
+
+	first := off / f.blockSize
+	if newLast > oldLast && oldLast < first {
+		first = oldLast // the old final block is no longer final
+	}
+	for i := first; i <= newLast; i++ {
+		start := i * f.blockSize
+		var block []byte
+		if start < f.size || i == oldLast {
+			b, err := f.readBlock(i, i == oldLast)
+			if err != nil {
+				return err
+			}
+			block = b
+		}
+		blockLen := size - start
+		if blockLen > f.blockSize {
+			blockLen = f.blockSize
+		}
+		if int64(len(block)) < blockLen {
+			block = append(block, make([]byte, blockLen-int64(len(block)))...)
+		}
+		if off < start+blockLen && end > start {
+			lo, hi := off-start, end-start
+			if lo < 0 {
+				lo = 0
+			}
+			if hi > blockLen {
+				hi = blockLen
+			}
+			copy(block[lo:hi], p[start+lo-off:])
+		}
+		if err := f.writeBlock(i, block, i == newLast); err != nil {
+			return err
+		}
+	}
+	f.size = size
+	return nil
+}
+
+func (f *File) lastBlock() int64 {
+	if f.size == 0 {
+		return 0
+	}
+	return (f.size - 1) / f.blockSize
+}
+
+func (f *File) blockOffset(i int64) int64 {
+	return fileHeaderSize + i*(f.blockSize+fileOverhead)
+}
+
+// readBlock reads and decrypts the i-th block.
+func (f *File) readBlock(i int64, final bool) ([]byte, error) {
+	length := f.blockSize
+	if final {
+		length = f.size - i*f.blockSize
+	}
+	buf := make([]byte, length+fileOverhead)
+	if _, err := f.f.ReadAt(buf, f.blockOffset(i)); err != nil {
+		if err == io.EOF {
+			err = errFileFormat
+		}
+		return nil, err
+	}
+	return f.aead.Open(buf[fileNonceSize:fileNonceSize], buf[:fileNonceSize], buf[fileNonceSize:], f.blockAD(i, final))
+}
+
+// writeBlock encrypts and writes the i-th block.
+func (f *File) writeBlock(i int64, plaintext []byte, final bool) error {
+	buf := make([]byte, fileNonceSize, fileOverhead+len(plaintext))
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return err
+	}
+	buf = f.aead.Seal(buf, buf[:fileNonceSize], plaintext, f.blockAD(i, final))
+	_, err := f.f.WriteAt(buf, f.blockOffset(i))
+	return err
+}
+
+func (f *File) blockAD(i int64, final bool) []byte {
+	ad := make([]byte, fileHeaderSize+9)
+	copy(ad, f.header[:])
+	binary.BigEndian.PutUint64(ad[fileHeaderSize:], uint64(i))
+	if final {
+		ad[fileHeaderSize+8] = 1
+	}
+	return ad
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createFile(t *testing.T, key []byte, blockSize int) (*File, string) {
+	dir, err := ioutil.TempDir("", "siv-file")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "file")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	file, err := NewFile(f, key, blockSize)
+	if err != nil {
+		t.Fatalf("Failed to create encrypted file: %v", err)
+	}
+	return file, path
+}
+
+func reopenFile(t *testing.T, path string, key []byte) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	file, err := OpenFile(f, key)
+	if err != nil {
+		f.Close()
+	}
+	return file, err
+}
+
+var fileTests = []struct {
+	blockSize int
+	offset    int64
+	length    int
+	truncate  int64
+}{
+	{blockSize: 16, offset: 0, length: 0, truncate: 0},
+	{blockSize: 16, offset: 0, length: 16, truncate: 16},
+	{blockSize: 16, offset: 5, length: 40, truncate: 20},
+	{blockSize: 16, offset: 100, length: 3, truncate: 200},
+	{blockSize: 64, offset: 63, length: 2, truncate: 1},
+	{blockSize: 64, offset: 0, length: 1000, truncate: 0},
+	{blockSize: DefaultBlockSize, offset: 4000, length: 10000, truncate: 8192},
+}
+
+func TestFile(t *testing.T) {
+	key := make([]byte, 32)
+	random := rand.New(rand.NewSource(1))
+	for i, test := range fileTests {
+		file, path := createFile(t, key, test.blockSize)
+		var want []byte
+
+		// Write some initial data followed by an overlapping write.
+		for j := 0; j < 2; j++ {
+			data := make([]byte, test.length)
+			random.Read(data)
+			off := test.offset + int64(j*test.length/2)
+			if _, err := file.WriteAt(data, off); err != nil {
+				t.Fatalf("Test %d: WriteAt failed: %v", i, err)
+			}
+			if end := off + int64(len(data)); end > int64(len(want)) {
+				want = append(want, make([]byte, end-int64(len(want)))...)
+			}
+			copy(want[off:], data)
+		}
+		if err := file.Truncate(test.truncate); err != nil {
+			t.Fatalf("Test %d: Truncate failed: %v", i, err)
+		}
+		if test.truncate > int64(len(want)) {
+			want = append(want, make([]byte, test.truncate-int64(len(want)))...)
+		}
+		want = want[:test.truncate]
+		if err := file.Sync(); err != nil {
+			t.Fatalf("Test %d: Sync failed: %v", i, err)
+		}
+		file.Close()
+
+		file, err := reopenFile(t, path, key)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to open encrypted file: %v", i, err)
+		}
+		if size := file.Size(); size != int64(len(want)) {
+			t.Fatalf("Test %d: size mismatch: got %d - want %d", i, size, len(want))
+		}
+		got, err := ioutil.ReadAll(io.NewSectionReader(file, 0, file.Size()+1))
+		if err != nil {
+			t.Fatalf("Test %d: ReadAt failed: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Test %d: content mismatch", i)
+		}
+		if len(want) > 1 {
+			buf := make([]byte, len(want)-1)
+			if n, err := file.ReadAt(buf, 1); err != nil || !bytes.Equal(buf[:n], want[1:]) {
+				t.Fatalf("Test %d: ReadAt at offset 1 failed: %v", i, err)
+			}
+		}
+		file.Close()
+	}
+}
+
+func TestFileTampering(t *testing.T) {
+	key := make([]byte, 16)
+	file, path := createFile(t, key, 32)
+	data := make([]byte, 100)
+	if _, err := file.WriteAt(data, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	file.Close()
+
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	blockLen := 32 + fileOverhead
+
+	swapped := append([]byte(nil), original...)
+	copy(swapped[fileHeaderSize:], original[fileHeaderSize+blockLen:fileHeaderSize+2*blockLen])
+	copy(swapped[fileHeaderSize+blockLen:], original[fileHeaderSize:fileHeaderSize+blockLen])
+
+	flipped := append([]byte(nil), original...)
+	flipped[fileHeaderSize+fileNonceSize+1] ^= 1
+
+	header := append([]byte(nil), original...)
+	header[fileHeaderSize-1] ^= 1
+
+	tests := map[string]struct {
+		data       []byte
+		failOnOpen bool
+	}{
+		"swapped blocks":      {data: swapped},
+		"modified block":      {data: flipped},
+		"modified header":     {data: header, failOnOpen: true},
+		"truncated block":     {data: original[:len(original)-1], failOnOpen: true},
+		"truncated at block":  {data: original[:fileHeaderSize+3*blockLen], failOnOpen: true},
+		"truncated to header": {data: original[:fileHeaderSize], failOnOpen: true},
+	}
+	for name, test := range tests {
+		if err = ioutil.WriteFile(path, test.data, 0600); err != nil {
+			t.Fatalf("%s: Failed to write file: %v", name, err)
+		}
+		file, err := reopenFile(t, path, key)
+		if test.failOnOpen {
+			if err == nil {
+				file.Close()
+				t.Fatalf("%s: OpenFile succeeded", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: OpenFile failed: %v", name, err)
+		}
+		if _, err = file.ReadAt(make([]byte, 100), 0); err == nil {
+			t.Fatalf("%s: ReadAt succeeded", name)
+		}
+		file.Close()
+	}
+
+	if err = ioutil.WriteFile(path, original, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err = reopenFile(t, path, make([]byte, 32)); err == nil {
+		t.Fatal("OpenFile succeeded with wrong key")
+	}
+}
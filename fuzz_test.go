@@ -0,0 +1,119 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+)
+
+// The fuzz targets compare every backend supported by the CPU
+// with the generic implementation. The key size is selected by
+// keySize and the key, nonce and additional data are padded or
+// truncated as necessary. All buffers start at the given offset
+// to catch alignment issues of the assembler code. The seed
+// corpus is located in testdata/fuzz.
+
+func FuzzCMAC(f *testing.F) {
+	for _, n := range []int{0, 1, 15, 16, 17, 63, 64, 65, 127, 128, 129, 255, 256, 257} {
+		f.Add(uint8(n), make([]byte, 64), make([]byte, 16), []byte("additional data"), make([]byte, n), uint8(n%16))
+	}
+	f.Fuzz(func(t *testing.T, keySize uint8, key, nonce, additionalData, plaintext []byte, offset uint8) {
+		key = resize(key, 32+16*int(keySize%3))
+		if len(nonce) < 16 {
+			nonce = nil
+		} else {
+			nonce = nonce[:16]
+		}
+		ref, _ := newCMAC(key, BackendGeneric, false)
+		for _, b := range Backends() {
+			c, err := newCMAC(key, b, false)
+			if err != nil {
+				t.Fatalf("Backend %s: failed to create AES-SIV-CMAC: %v", b, err)
+			}
+			fuzzAEAD(t, b, &aesSivCMac{ref}, &aesSivCMac{c}, nonce, additionalData, plaintext, int(offset))
+		}
+	})
+}
+
+func FuzzGCM(f *testing.F) {
+	for _, n := range []int{0, 1, 15, 16, 17, 63, 64, 65, 127, 128, 129, 255, 256, 257} {
+		f.Add(uint8(n), make([]byte, 32), make([]byte, 12), []byte("additional data"), make([]byte, n), uint8(n%16))
+	}
+	f.Fuzz(func(t *testing.T, keySize uint8, key, nonce, additionalData, plaintext []byte, offset uint8) {
+		key = resize(key, 16+16*int(keySize%2))
+		nonce = resize(nonce, 12)
+		ref, _ := newGCMGeneric(key, false)
+		for _, b := range Backends() {
+			c, err := newGCM(key, b, false)
+			if err != nil {
+				t.Fatalf("Backend %s: failed to create AES-GCM-SIV: %v", b, err)
+			}
+			fuzzAEAD(t, b, &aesGcmSiv{ref}, &aesGcmSiv{c}, nonce, additionalData, plaintext, int(offset))
+		}
+	})
+}
+
+// fuzzAEAD checks that c produces the same output as the
+// reference AEAD ref - with distinct and with aliasing buffers.
+// All input and output buffers start at offset bytes past an
+// aligned address.
+func fuzzAEAD(t *testing.T, b Backend, ref, c cipher.AEAD, nonce, additionalData, plaintext []byte, offset int) {
+	ciphertext := ref.Seal(nil, nonce, plaintext, additionalData)
+	nonce = misalign(nonce, offset)
+	additionalData = misalign(additionalData, offset)
+
+	buf := make([]byte, offset+len(ciphertext))
+	if sealed := c.Seal(buf[offset:offset], nonce, misalign(plaintext, offset), additionalData); !bytes.Equal(sealed, ciphertext) {
+		t.Fatalf("Backend %s: Seal - ciphertext mismatch", b)
+	}
+	out := make([]byte, offset+len(plaintext))
+	if opened, err := c.Open(out[offset:offset], nonce, misalign(ciphertext, offset), additionalData); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Backend %s: Open - plaintext mismatch: %v", b, err)
+	}
+
+	// In-place encryption and decryption
+	pt := buf[offset : offset+len(plaintext)]
+	copy(pt, plaintext)
+	sealed := c.Seal(pt[:0], nonce, pt, additionalData)
+	if !bytes.Equal(sealed, ciphertext) {
+		t.Fatalf("Backend %s: in-place Seal - ciphertext mismatch", b)
+	}
+	if opened, err := c.Open(sealed[:0], nonce, sealed, additionalData); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Backend %s: in-place Open - plaintext mismatch: %v", b, err)
+	}
+
+	// Decrypting an arbitrary ciphertext must produce the same result.
+	if len(plaintext) >= c.Overhead() {
+		refPlaintext, refErr := ref.Open(nil, nonce, plaintext, additionalData)
+		p, err := c.Open(nil, nonce, misalign(plaintext, offset), additionalData)
+		if (err == nil) != (refErr == nil) || !bytes.Equal(p, refPlaintext) {
+			t.Fatalf("Backend %s: Open - result mismatch: %v - %v", b, err, refErr)
+		}
+	}
+
+	copy(buf[offset:], ciphertext)
+	buf[offset+len(ciphertext)/2] ^= 1
+	if _, err := c.Open(nil, nonce, buf[offset:], additionalData); err == nil {
+		t.Fatalf("Backend %s: Open accepted a modified ciphertext", b)
+	}
+}
+
+// misalign returns a copy of b starting offset
+// bytes past the start of a new allocation.
+func misalign(b []byte, offset int) []byte {
+	r := make([]byte, offset+len(b))
+	copy(r[offset:], b)
+	return r[offset:]
+}
+
+// resize returns a slice of length n holding
+// the first n bytes of b - padded with zeros.
+func resize(b []byte, n int) []byte {
+	r := make([]byte, n)
+	copy(r, b)
+	return r
+}
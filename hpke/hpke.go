@@ -0,0 +1,423 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package hpke implements Hybrid Public Key Encryption (HPKE)
+// as specified in RFC 9180 using AES-GCM-SIV as AEAD.
+//
+// The package supports the base and PSK modes with the
+// DHKEM(X25519, HKDF-SHA256) KEM and the HKDF-SHA256 KDF.
+// The AEAD is AES-GCM-SIV as implemented by siv.NewGCM.
+// Since AES-GCM-SIV is misuse-resistant, a broken sender
+// RNG or a repeated sequence number does not destroy the
+// confidentiality of the encrypted messages completely.
+//
+// AES-GCM-SIV is not part of the HPKE AEAD registry. The
+// AEAD identifiers used by this package are private and
+// non-standard. Other HPKE implementations will not be able
+// to decrypt messages produced by this package - unless they
+// implement AES-GCM-SIV with the same identifiers.
+package hpke
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// AEAD is an HPKE AEAD identifier.
+type AEAD uint16
+
+// The AEAD identifiers for AES-GCM-SIV. These identifiers
+// are NOT registered with IANA and are NOT part of RFC 9180.
+// They are private to this package.
+const (
+	AES128GCMSIV AEAD = 0xFF01
+	AES256GCMSIV AEAD = 0xFF02
+)
+
+// The KEM and KDF identifiers as registered in RFC 9180.
+const (
+	KEMX25519HKDFSHA256 uint16 = 0x0020
+	KDFHKDFSHA256       uint16 = 0x0001
+)
+
+const (
+	modeBase byte = 0x00
+	modePSK  byte = 0x01
+)
+
+const (
+	nSecret = 32 // size of the KEM shared secret
+	nEnc    = 32 // size of the encapsulated key
+	nNonce  = 12 // size of the AEAD nonce
+)
+
+var (
+	errAEAD      = errors.New("hpke: unsupported AEAD")
+	errPSK       = errors.New("hpke: psk and psk ID must be either both empty or both non-empty")
+	errOverflow  = errors.New("hpke: message limit reached")
+	errEncapsKey = errors.New("hpke: invalid encapsulated key")
+	errLength    = errors.New("hpke: invalid length of exported secret")
+)
+
+// KeySize returns the size of the AEAD key.
+func (a AEAD) KeySize() int {
+	switch a {
+	case AES128GCMSIV:
+		return 16
+	case AES256GCMSIV:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// Seal encrypts and authenticates plaintext and additionalData
+// for the recipient public key pkR in the base mode. It returns
+// the encapsulated key and the ciphertext. The recipient public
+// key must be an X25519 key.
+func Seal(pkR *ecdh.PublicKey, aead AEAD, info, plaintext, additionalData []byte) (enc, ciphertext []byte, err error) {
+	enc, s, err := SetupBaseSender(pkR, aead, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err = s.Seal(plaintext, additionalData)
+	return enc, ciphertext, err
+}
+
+// Open decrypts and authenticates a ciphertext produced by Seal
+// using the recipient private key skR and the encapsulated key.
+func Open(skR *ecdh.PrivateKey, aead AEAD, enc, info, ciphertext, additionalData []byte) ([]byte, error) {
+	r, err := SetupBaseReceiver(skR, aead, enc, info)
+	if err != nil {
+		return nil, err
+	}
+	return r.Open(ciphertext, additionalData)
+}
+
+// SealPSK is like Seal but uses the PSK mode with the pre-shared
+// key psk and its identifier pskID.
+func SealPSK(pkR *ecdh.PublicKey, aead AEAD, info, psk, pskID, plaintext, additionalData []byte) (enc, ciphertext []byte, err error) {
+	enc, s, err := SetupPSKSender(pkR, aead, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err = s.Seal(plaintext, additionalData)
+	return enc, ciphertext, err
+}
+
+// OpenPSK is like Open but uses the PSK mode with the pre-shared
+// key psk and its identifier pskID.
+func OpenPSK(skR *ecdh.PrivateKey, aead AEAD, enc, info, psk, pskID, ciphertext, additionalData []byte) ([]byte, error) {
+	r, err := SetupPSKReceiver(skR, aead, enc, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+	return r.Open(ciphertext, additionalData)
+}
+
+// Sender is an HPKE sender context. It encrypts a sequence
+// of messages for one recipient. A Sender is not safe for
+// concurrent use by multiple goroutines.
+type Sender struct{ context }
+
+// Receiver is an HPKE recipient context. It decrypts a
+// sequence of messages produced by the corresponding
+// Sender in the same order. A Receiver is not safe for
+// concurrent use by multiple goroutines.
+type Receiver struct{ context }
+
+// SetupBaseSender returns the encapsulated key and a sender
+// context for the recipient public key pkR in the base mode.
+func SetupBaseSender(pkR *ecdh.PublicKey, aead AEAD, info []byte) ([]byte, *Sender, error) {
+	return setupSender(rand.Reader, pkR, aead, modeBase, info, nil, nil)
+}
+
+// SetupPSKSender returns the encapsulated key and a sender
+// context for the recipient public key pkR in the PSK mode.
+func SetupPSKSender(pkR *ecdh.PublicKey, aead AEAD, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	return setupSender(rand.Reader, pkR, aead, modePSK, info, psk, pskID)
+}
+
+// SetupBaseReceiver returns a recipient context for the
+// encapsulated key and the recipient private key skR in
+// the base mode.
+func SetupBaseReceiver(skR *ecdh.PrivateKey, aead AEAD, enc, info []byte) (*Receiver, error) {
+	return setupReceiver(skR, aead, enc, modeBase, info, nil, nil)
+}
+
+// SetupPSKReceiver returns a recipient context for the
+// encapsulated key and the recipient private key skR in
+// the PSK mode.
+func SetupPSKReceiver(skR *ecdh.PrivateKey, aead AEAD, enc, info, psk, pskID []byte) (*Receiver, error) {
+	return setupReceiver(skR, aead, enc, modePSK, info, psk, pskID)
+}
+
+// Seal encrypts and authenticates the next message of the
+// sequence.
+func (s *Sender) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce, err := s.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts and authenticates the next message of the
+// sequence.
+func (r *Receiver) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	if r.seq == r.maxSeq {
+		return nil, errOverflow
+	}
+	nonce := r.computeNonce()
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	r.seq++
+	return plaintext, nil
+}
+
+// Export derives a secret of the given length from the sender
+// context using exporterContext as domain separator. The length
+// must not be negative or larger than 255*32 bytes.
+func (s *Sender) Export(exporterContext []byte, length int) ([]byte, error) {
+	return s.export(exporterContext, length)
+}
+
+// Export derives a secret of the given length from the recipient
+// context using exporterContext as domain separator. The length
+// must not be negative or larger than 255*32 bytes.
+func (r *Receiver) Export(exporterContext []byte, length int) ([]byte, error) {
+	return r.export(exporterContext, length)
+}
+
+func setupSender(random io.Reader, pkR *ecdh.PublicKey, aead AEAD, mode byte, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	skE, err := ecdh.X25519().GenerateKey(random)
+	if err != nil {
+		return nil, nil, err
+	}
+	return setupSenderWithKey(skE, pkR, aead, mode, info, psk, pskID)
+}
+
+// setupSenderWithKey is like setupSender but uses the given
+// ephemeral private key.
+func setupSenderWithKey(skE *ecdh.PrivateKey, pkR *ecdh.PublicKey, aead AEAD, mode byte, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	sharedSecret, enc, err := encap(skE, pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := keySchedule(aead, mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, &Sender{c}, nil
+}
+
+func setupReceiver(skR *ecdh.PrivateKey, aead AEAD, enc []byte, mode byte, info, psk, pskID []byte) (*Receiver, error) {
+	sharedSecret, err := decap(skR, enc)
+	if err != nil {
+		return nil, err
+	}
+	c, err := keySchedule(aead, mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{c}, nil
+}
+
+// encap implements DHKEM(X25519, HKDF-SHA256) Encap using
+// the ephemeral private key skE.
+func encap(skE *ecdh.PrivateKey, pkR *ecdh.PublicKey) (sharedSecret, enc []byte, err error) {
+	dh, err := skE.ECDH(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc = skE.PublicKey().Bytes()
+	kemContext := append(append([]byte(nil), enc...), pkR.Bytes()...)
+	sharedSecret, err = extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sharedSecret, enc, nil
+}
+
+// decap implements DHKEM(X25519, HKDF-SHA256) Decap.
+func decap(skR *ecdh.PrivateKey, enc []byte) ([]byte, error) {
+	if len(enc) != nEnc {
+		return nil, errEncapsKey
+	}
+	pkE, err := ecdh.X25519().NewPublicKey(enc)
+	if err != nil {
+		return nil, errEncapsKey
+	}
+	dh, err := skR.ECDH(pkE)
+	if err != nil {
+		return nil, err
+	}
+	kemContext := append(append([]byte(nil), enc...), skR.PublicKey().Bytes()...)
+	return extractAndExpand(dh, kemContext)
+}
+
+func extractAndExpand(dh, kemContext []byte) ([]byte, error) {
+	prk := kemSuite.labeledExtract(nil, "eae_prk", dh)
+	return kemSuite.labeledExpand(prk, "shared_secret", kemContext, nSecret)
+}
+
+// DeriveKeyPair derives an X25519 key pair from the input
+// keying material ikm as specified by RFC 9180 Section 7.1.3.
+func DeriveKeyPair(ikm []byte) (*ecdh.PrivateKey, error) {
+	prk := kemSuite.labeledExtract(nil, "dkp_prk", ikm)
+	sk, err := kemSuite.labeledExpand(prk, "sk", nil, 32)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPrivateKey(sk)
+}
+
+type context struct {
+	suite          suite
+	aead           cipher.AEAD
+	baseNonce      []byte
+	exporterSecret []byte
+	seq            uint64
+	maxSeq         uint64
+}
+
+func keySchedule(aead AEAD, mode byte, sharedSecret, info, psk, pskID []byte) (context, error) {
+	if aead.KeySize() == 0 {
+		return context{}, errAEAD
+	}
+	c, key, err := deriveContext(uint16(aead), aead.KeySize(), mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return context{}, err
+	}
+	if c.aead, err = siv.NewGCM(key); err != nil {
+		return context{}, err
+	}
+	return c, nil
+}
+
+// deriveContext implements the HPKE key schedule for an AEAD
+// with the given identifier and key size. It returns the context
+// - without AEAD - and the AEAD key.
+func deriveContext(aeadID uint16, keySize int, mode byte, sharedSecret, info, psk, pskID []byte) (context, []byte, error) {
+	if (len(psk) == 0) != (len(pskID) == 0) {
+		return context{}, nil, errPSK
+	}
+	if (mode == modeBase) != (len(psk) == 0) {
+		return context{}, nil, errPSK
+	}
+
+	s := newSuite(aeadID)
+	keyScheduleContext := []byte{mode}
+	keyScheduleContext = append(keyScheduleContext, s.labeledExtract(nil, "psk_id_hash", pskID)...)
+	keyScheduleContext = append(keyScheduleContext, s.labeledExtract(nil, "info_hash", info)...)
+
+	secret := s.labeledExtract(sharedSecret, "secret", psk)
+	baseNonce, err := s.labeledExpand(secret, "base_nonce", keyScheduleContext, nNonce)
+	if err != nil {
+		return context{}, nil, err
+	}
+	exporterSecret, err := s.labeledExpand(secret, "exp", keyScheduleContext, sha256.Size)
+	if err != nil {
+		return context{}, nil, err
+	}
+	key, err := s.labeledExpand(secret, "key", keyScheduleContext, keySize)
+	if err != nil {
+		return context{}, nil, err
+	}
+	c := context{
+		suite:          s,
+		baseNonce:      baseNonce,
+		exporterSecret: exporterSecret,
+		maxSeq:         ^uint64(0),
+	}
+	return c, key, nil
+}
+
+func (c *context) export(exporterContext []byte, length int) ([]byte, error) {
+	return c.suite.labeledExpand(c.exporterSecret, "sec", exporterContext, length)
+}
+
+func (c *context) computeNonce() []byte {
+	nonce := make([]byte, nNonce)
+	binary.BigEndian.PutUint64(nonce[nNonce-8:], c.seq)
+	for i := range nonce {
+		nonce[i] ^= c.baseNonce[i]
+	}
+	return nonce
+}
+
+func (c *context) nextNonce() ([]byte, error) {
+	if c.seq == c.maxSeq {
+		return nil, errOverflow
+	}
+	nonce := c.computeNonce()
+	c.seq++
+	return nonce, nil
+}
+
+// suite is an HPKE suite identifier used for
+// domain separation of the labeled KDF calls.
+type suite []byte
+
+var kemSuite = suite{'K', 'E', 'M', byte(KEMX25519HKDFSHA256 >> 8), byte(KEMX25519HKDFSHA256)}
+
+func newSuite(aeadID uint16) suite {
+	s := suite{'H', 'P', 'K', 'E', 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(s[4:], KEMX25519HKDFSHA256)
+	binary.BigEndian.PutUint16(s[6:], KDFHKDFSHA256)
+	binary.BigEndian.PutUint16(s[8:], aeadID)
+	return s
+}
+
+func (s suite) labeledExtract(salt []byte, label string, ikm []byte) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte("HPKE-v1"))
+	mac.Write(s)
+	mac.Write([]byte(label))
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// labeledExpand implements LabeledExpand of RFC 9180 Section 4.
+// It returns an error if length is negative or larger than the
+// 255*Nh bytes HKDF-Expand can produce.
+func (s suite) labeledExpand(prk []byte, label string, info []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*sha256.Size {
+		return nil, errLength
+	}
+	labeledInfo := []byte{byte(length >> 8), byte(length)}
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, s...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+
+	// HKDF-Expand as specified in RFC 5869
+	var (
+		out  []byte
+		prev []byte
+		mac  = hmac.New(sha256.New, prk)
+	)
+	for i := byte(1); len(out) < length; i++ {
+		mac.Reset()
+		mac.Write(prev)
+		mac.Write(labeledInfo)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length], nil
+}
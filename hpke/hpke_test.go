@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package hpke
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecode(s string) []byte {
+	v, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// keyScheduleTests are the DHKEM(X25519, HKDF-SHA256), HKDF-SHA256,
+// AES-128-GCM test vectors of RFC 9180 Appendix A.1. They verify the
+// KEM and the key schedule - which are independent of the AEAD except
+// for its identifier and key size.
+var keyScheduleTests = []struct {
+	mode                           byte
+	ikmE, ikmR, info, psk, pskID   string
+	enc, sharedSecret              string
+	key, baseNonce, exporterSecret string
+}{
+	{
+		mode:           modeBase,
+		ikmE:           "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234",
+		ikmR:           "6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037",
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		enc:            "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431",
+		sharedSecret:   "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc",
+		key:            "4531685d41d65f03dc48f6b8302c05b0",
+		baseNonce:      "56d890e5accaaf011cff4b7d",
+		exporterSecret: "45ff1c2e220db587171952c0592d5f5ebe103f1561a2614e38f2ffd47e99e3f8",
+	},
+	{
+		mode:           modePSK,
+		ikmE:           "78628c354e46f3e169bd231be7b2ff1c77aa302460a26dbfa15515684c00130b",
+		ikmR:           "d4a09d09f575fef425905d2ab396c1449141463f698f8efdb7accfaff8995098",
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "0ad0950d9fb9588e59690b74f1237ecdf1d775cd60be2eca57af5a4b0471c91b",
+		sharedSecret:   "727699f009ffe3c076315019c69648366b69171439bd7dd0807743bde76986cd",
+		key:            "15026dba546e3ae05836fc7de5a7bb26",
+		baseNonce:      "9518635eba129d5ce0914555",
+		exporterSecret: "3d76025dbbedc49448ec3f9080a1abab6b06e91c0b11ad23c912f043a0ee7655",
+	},
+}
+
+func TestKeySchedule(t *testing.T) {
+	const aes128GCM = 0x0001
+	for i, test := range keyScheduleTests {
+		skE, err := DeriveKeyPair(mustDecode(test.ikmE))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to derive ephemeral key pair: %v", i, err)
+		}
+		skR, err := DeriveKeyPair(mustDecode(test.ikmR))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to derive recipient key pair: %v", i, err)
+		}
+		sharedSecret, enc, err := encap(skE, skR.PublicKey())
+		if err != nil {
+			t.Fatalf("Test %d: Encap failed: %v", i, err)
+		}
+		if !bytes.Equal(enc, mustDecode(test.enc)) {
+			t.Errorf("Test %d: enc mismatch: got %x", i, enc)
+		}
+		if !bytes.Equal(sharedSecret, mustDecode(test.sharedSecret)) {
+			t.Errorf("Test %d: shared secret mismatch: got %x", i, sharedSecret)
+		}
+		decapSecret, err := decap(skR, enc)
+		if err != nil {
+			t.Fatalf("Test %d: Decap failed: %v", i, err)
+		}
+		if !bytes.Equal(decapSecret, sharedSecret) {
+			t.Errorf("Test %d: Decap shared secret mismatch: got %x", i, decapSecret)
+		}
+
+		c, key, err := deriveContext(aes128GCM, 16, test.mode, sharedSecret, mustDecode(test.info), mustDecode(test.psk), mustDecode(test.pskID))
+		if err != nil {
+			t.Fatalf("Test %d: Key schedule failed: %v", i, err)
+		}
+		if !bytes.Equal(key, mustDecode(test.key)) {
+			t.Errorf("Test %d: key mismatch: got %x", i, key)
+		}
+		if !bytes.Equal(c.baseNonce, mustDecode(test.baseNonce)) {
+			t.Errorf("Test %d: base nonce mismatch: got %x", i, c.baseNonce)
+		}
+		if !bytes.Equal(c.exporterSecret, mustDecode(test.exporterSecret)) {
+			t.Errorf("Test %d: exporter secret mismatch: got %x", i, c.exporterSecret)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	skR, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate recipient key: %v", err)
+	}
+	info, plaintext, additionalData := []byte("info"), []byte("plaintext"), []byte("additional data")
+	psk, pskID := make([]byte, 32), []byte("psk ID")
+
+	for _, aead := range []AEAD{AES128GCMSIV, AES256GCMSIV} {
+		enc, ciphertext, err := Seal(skR.PublicKey(), aead, info, plaintext, additionalData)
+		if err != nil {
+			t.Fatalf("AEAD %04x: Seal failed: %v", aead, err)
+		}
+		p, err := Open(skR, aead, enc, info, ciphertext, additionalData)
+		if err != nil {
+			t.Fatalf("AEAD %04x: Open failed: %v", aead, err)
+		}
+		if !bytes.Equal(p, plaintext) {
+			t.Fatalf("AEAD %04x: plaintext mismatch", aead)
+		}
+		if _, err = Open(skR, aead, enc, []byte("other info"), ciphertext, additionalData); err == nil {
+			t.Fatalf("AEAD %04x: Open succeeded with different info", aead)
+		}
+
+		enc, ciphertext, err = SealPSK(skR.PublicKey(), aead, info, psk, pskID, plaintext, additionalData)
+		if err != nil {
+			t.Fatalf("AEAD %04x: SealPSK failed: %v", aead, err)
+		}
+		if p, err = OpenPSK(skR, aead, enc, info, psk, pskID, ciphertext, additionalData); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("AEAD %04x: OpenPSK failed: %v", aead, err)
+		}
+		if _, err = Open(skR, aead, enc, info, ciphertext, additionalData); err == nil {
+			t.Fatalf("AEAD %04x: Open succeeded for PSK ciphertext", aead)
+		}
+	}
+
+	if _, _, err = SealPSK(skR.PublicKey(), AES128GCMSIV, info, psk, nil, plaintext, nil); err == nil {
+		t.Fatal("SealPSK succeeded without psk ID")
+	}
+	if _, _, err = Seal(skR.PublicKey(), AEAD(0x0001), info, plaintext, nil); err == nil {
+		t.Fatal("Seal succeeded with unsupported AEAD")
+	}
+}
+
+func TestContext(t *testing.T) {
+	skR, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate recipient key: %v", err)
+	}
+	enc, s, err := SetupBaseSender(skR.PublicKey(), AES256GCMSIV, nil)
+	if err != nil {
+		t.Fatalf("Failed to setup sender: %v", err)
+	}
+	r, err := SetupBaseReceiver(skR, AES256GCMSIV, enc, nil)
+	if err != nil {
+		t.Fatalf("Failed to setup receiver: %v", err)
+	}
+
+	var ciphertexts [][]byte
+	for i := 0; i < 3; i++ {
+		ciphertext, err := s.Seal([]byte("plaintext"), nil)
+		if err != nil {
+			t.Fatalf("Test %d: Seal failed: %v", i, err)
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	if bytes.Equal(ciphertexts[0], ciphertexts[1]) {
+		t.Fatal("Sender reused a nonce")
+	}
+	if _, err = r.Open(ciphertexts[1], nil); err == nil {
+		t.Fatal("Receiver accepted out-of-order message")
+	}
+	for i, ciphertext := range ciphertexts {
+		if _, err = r.Open(ciphertext, nil); err != nil {
+			t.Fatalf("Test %d: Open failed: %v", i, err)
+		}
+	}
+
+	sExport, err := s.Export([]byte("context"), 42)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	rExport, err := r.Export([]byte("context"), 42)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if !bytes.Equal(sExport, rExport) {
+		t.Fatal("Exported secrets do not match")
+	}
+	if secret, err := s.Export(nil, 255*32); err != nil || len(secret) != 255*32 {
+		t.Fatalf("Export of the maximum length failed: %v", err)
+	}
+	for _, length := range []int{-1, 255*32 + 1, 1 << 16} {
+		if _, err = s.Export(nil, length); err != errLength {
+			t.Fatalf("Export accepted length %d", length)
+		}
+	}
+}
@@ -0,0 +1,700 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package jsonfield implements field-level encryption for JSON
+// documents.
+//
+// Struct fields tagged with `siv:"deterministic"` or `siv:"random"`
+// are encrypted when a value is marshaled and decrypted when it is
+// unmarshaled. All other fields remain readable:
+//
+//	type User struct {
+//		Name  string `json:"name"`
+//		Email string `json:"email" siv:"deterministic"`
+//		SSN   string `json:"ssn" siv:"random"`
+//	}
+//
+// The JSON encoding of a tagged field is encrypted with AES-SIV-CMAC
+// (siv.NewCMAC with an empty nonce) for "deterministic" fields or
+// with AES-GCM-SIV (siv.NewGCM) under a random nonce for "random"
+// fields. Deterministic fields always encrypt to the same value and
+// can therefore be compared for equality. A random field is stored
+// as the 12 byte nonce followed by the ciphertext. The result is
+// emitted as unpadded base64url string.
+//
+// The JSON Pointer (RFC 6901) of a field - for example "/users/2/ssn"
+// - is bound as additional data. Therefore, an encrypted field cannot
+// be moved to another field, array index or map key. However, an
+// encrypted field can be removed from a document.
+//
+// Tagged fields may be nested within structs, pointers, slices,
+// arrays and maps with string keys. Fields of embedded structs are
+// promoted following the rules of encoding/json. Field names are
+// matched exactly when unmarshaling.
+//
+// A tagged field within an interface value or within a type that
+// implements json.Marshaler or json.Unmarshaler would be encoded
+// by encoding/json without encryption. Marshal and Unmarshal return
+// an error for such values. Marshal and Unmarshal also return an
+// error if a "siv" tag is invalid.
+package jsonfield
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// Encryption modes - the values of the "siv" struct tag.
+const (
+	Deterministic = "deterministic"
+	Random        = "random"
+)
+
+const nonceSize = 12
+
+var encoding = base64.RawURLEncoding
+
+var (
+	errNoKey      = errors.New("jsonfield: no key for encryption mode")
+	errNotPointer = errors.New("jsonfield: Unmarshal requires a non-nil pointer")
+	errNotString  = errors.New("jsonfield: encrypted field is not a string")
+	errCiphertext = errors.New("jsonfield: invalid encrypted field")
+	errInterface  = errors.New("jsonfield: tagged field within interface value")
+)
+
+// Keys contains the keys used by a Codec. A key may be
+// nil if no field uses the corresponding mode.
+type Keys struct {
+	// Deterministic encrypts fields tagged `siv:"deterministic"`
+	// using AES-SIV-CMAC. It must be 32, 48 or 64 bytes long.
+	Deterministic []byte
+
+	// Random encrypts fields tagged `siv:"random"` using
+	// AES-GCM-SIV. It must be 16 or 32 bytes long.
+	Random []byte
+}
+
+// Codec marshals and unmarshals JSON documents and encrypts
+// and decrypts tagged fields. It is safe for concurrent use
+// by multiple goroutines.
+type Codec struct {
+	deterministic cipher.AEAD
+	random        cipher.AEAD
+}
+
+// New returns a new Codec using the given keys.
+func New(keys Keys) (*Codec, error) {
+	c := new(Codec)
+	if keys.Deterministic != nil {
+		aead, err := siv.NewCMAC(keys.Deterministic)
+		if err != nil {
+			return nil, err
+		}
+		c.deterministic = aead
+	}
+	if keys.Random != nil {
+		aead, err := siv.NewGCM(keys.Random)
+		if err != nil {
+			return nil, err
+		}
+		c.random = aead
+	}
+	return c, nil
+}
+
+// Marshal returns the JSON encoding of v with all
+// tagged fields encrypted.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	tree, err := c.marshal(reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// Unmarshal parses the JSON-encoded data, decrypts all
+// tagged fields and stores the result in the value
+// pointed to by v.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errNotPointer
+	}
+	return c.unmarshal(data, rv.Elem(), "")
+}
+
+func (c *Codec) marshal(v reflect.Value, path string) (interface{}, error) {
+	if tagged, err := hasTaggedFields(v.Type()); err != nil || !tagged {
+		return v.Interface(), err
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if err := checkUntagged(v.Elem()); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return c.marshal(v.Elem(), path)
+	case reflect.Struct:
+		fields, err := cachedFields(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		var obj object
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			fieldPath := path + "/" + escape(f.name)
+			var (
+				value interface{}
+				err   error
+			)
+			if f.mode != "" {
+				value, err = c.seal(f.mode, fv, fieldPath)
+			} else {
+				value, err = c.marshal(fv, fieldPath)
+			}
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{name: f.name, value: value})
+		}
+		return obj, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elem, err := c.marshal(v.Index(i), path+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return elems, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("jsonfield: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		members := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			elem, err := c.marshal(iter.Value(), path+"/"+escape(key))
+			if err != nil {
+				return nil, err
+			}
+			members[key] = elem
+		}
+		return members, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+func (c *Codec) unmarshal(data []byte, v reflect.Value, path string) error {
+	if tagged, err := hasTaggedFields(v.Type()); err != nil || !tagged {
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return c.unmarshal(data, v.Elem(), path)
+	case reflect.Struct:
+		fields, err := cachedFields(v.Type())
+		if err != nil {
+			return err
+		}
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return err
+		}
+		for _, f := range fields {
+			m, ok := members[f.name]
+			if !ok {
+				continue
+			}
+			fv, _ := fieldByIndex(v, f.index, true)
+			fieldPath := path + "/" + escape(f.name)
+			var err error
+			if f.mode != "" {
+				err = c.open(f.mode, m, fv, fieldPath)
+			} else {
+				err = c.unmarshal(m, fv, fieldPath)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(elems), len(elems)))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(elems) {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				continue
+			}
+			if err := c.unmarshal(elems[i], v.Index(i), path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("jsonfield: unsupported map key type %s", v.Type().Key())
+		}
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(members)))
+		}
+		for key, m := range members {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := c.unmarshal(m, elem, path+"/"+escape(key)); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+// seal encrypts the JSON encoding of v.
+func (c *Codec) seal(mode string, v reflect.Value, path string) (string, error) {
+	plaintext, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	var ciphertext []byte
+	switch mode {
+	case Deterministic:
+		if c.deterministic == nil {
+			return "", errNoKey
+		}
+		ciphertext = c.deterministic.Seal(nil, nil, plaintext, []byte(path))
+	case Random:
+		if c.random == nil {
+			return "", errNoKey
+		}
+		ciphertext = make([]byte, nonceSize, nonceSize+len(plaintext)+c.random.Overhead())
+		if _, err = io.ReadFull(rand.Reader, ciphertext); err != nil {
+			return "", err
+		}
+		ciphertext = c.random.Seal(ciphertext, ciphertext[:nonceSize], plaintext, []byte(path))
+	}
+	return encoding.EncodeToString(ciphertext), nil
+}
+
+// open decrypts the encrypted field data and
+// stores the result in v.
+func (c *Codec) open(mode string, data []byte, v reflect.Value, path string) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errNotString
+	}
+	ciphertext, err := encoding.Strict().DecodeString(s)
+	if err != nil {
+		return errCiphertext
+	}
+	var plaintext []byte
+	switch mode {
+	case Deterministic:
+		if c.deterministic == nil {
+			return errNoKey
+		}
+		plaintext, err = c.deterministic.Open(nil, nil, ciphertext, []byte(path))
+	case Random:
+		if c.random == nil {
+			return errNoKey
+		}
+		if len(ciphertext) < nonceSize+c.random.Overhead() {
+			return errCiphertext
+		}
+		plaintext, err = c.random.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(path))
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v.Addr().Interface())
+}
+
+// object is a JSON object preserving the order of its members.
+type object []member
+
+type member struct {
+	name  string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, m := range o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		name, err := json.Marshal(m.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, name...)
+		buf = append(buf, ':')
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+// escape escapes a JSON Pointer reference token.
+func escape(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+type field struct {
+	name      string
+	index     []int
+	tagged    bool // the name is given by a "json" tag
+	omitEmpty bool
+	mode      string
+}
+
+type typeInfo struct {
+	fields []field
+	err    error
+}
+
+var fieldCache sync.Map // map[reflect.Type]typeInfo
+
+// cachedFields returns the JSON fields of the struct type t.
+// It returns an error if a field has an invalid "siv" tag.
+func cachedFields(t reflect.Type) ([]field, error) {
+	if info, ok := fieldCache.Load(t); ok {
+		return info.(typeInfo).fields, info.(typeInfo).err
+	}
+	fields, err := typeFields(t)
+	info, _ := fieldCache.LoadOrStore(t, typeInfo{fields: fields, err: err})
+	return info.(typeInfo).fields, info.(typeInfo).err
+}
+
+// typeFields returns the JSON fields of the struct type t. Like
+// encoding/json, it walks embedded structs breadth-first. If the
+// same name appears multiple times, the least nested field wins,
+// then the field named by a "json" tag. Remaining conflicts hide
+// all fields with the name.
+func typeFields(t reflect.Type) ([]field, error) {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var (
+		fields  []field
+		next    = []embedded{{typ: t}}
+		visited = map[reflect.Type]bool{}
+	)
+	for len(next) > 0 {
+		current := next
+		next = nil
+		count := map[reflect.Type]int{}
+		for _, e := range current {
+			count[e.typ]++
+		}
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if i := strings.Index(tag, ","); i >= 0 {
+					name, opts = tag[:i], tag[i+1:]
+				}
+				mode := sf.Tag.Get("siv")
+				if mode != "" && mode != Deterministic && mode != Random {
+					return nil, fmt.Errorf("jsonfield: invalid siv tag %q on field %s.%s", mode, e.typ.Name(), sf.Name)
+				}
+				index := append(append([]int{}, e.index...), i)
+
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if sf.PkgPath != "" && (name != "" || ft.Kind() != reflect.Struct) {
+						continue
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						if mode != "" {
+							return nil, fmt.Errorf("jsonfield: siv tag on embedded struct %s.%s without JSON name", e.typ.Name(), sf.Name)
+						}
+						next = append(next, embedded{typ: ft, index: index})
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+
+				f := field{
+					name:      name,
+					index:     index,
+					tagged:    name != "",
+					omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+					mode:      mode,
+				}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+				if count[e.typ] > 1 {
+					// The struct is embedded multiple times at the
+					// same depth. Its fields annihilate each other.
+					fields = append(fields, f)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	dominant := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j == i+1 || len(fields[i].index) < len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			dominant = append(dominant, fields[i])
+		}
+		i = j
+	}
+	fields = dominant
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields, nil
+}
+
+// fieldByIndex returns the nested field of v. If alloc is true,
+// nil embedded pointers are allocated. Otherwise, it returns
+// false if it encounters a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+type taggedInfo struct {
+	tagged bool
+	err    error
+}
+
+var taggedCache sync.Map // map[reflect.Type]taggedInfo
+
+// hasTaggedFields reports whether a value of type t may contain
+// fields with a "siv" tag. Interface values may contain tagged
+// fields. It returns an error if t contains tagged fields that
+// would be encoded by encoding/json - i.e. within a type that
+// implements json.Marshaler or json.Unmarshaler.
+func hasTaggedFields(t reflect.Type) (bool, error) {
+	if v, ok := taggedCache.Load(t); ok {
+		return v.(taggedInfo).tagged, v.(taggedInfo).err
+	}
+	tagged, err := searchTagged(t, map[reflect.Type]bool{}, true)
+	taggedCache.Store(t, taggedInfo{tagged: tagged, err: err})
+	return tagged, err
+}
+
+// searchTagged reports whether a value of type t may contain
+// fields with a "siv" tag. If dynamic is false, interfaces and
+// the json.Marshaler and json.Unmarshaler implementations are
+// ignored.
+func searchTagged(t reflect.Type, visiting map[reflect.Type]bool, dynamic bool) (bool, error) {
+	if visiting[t] {
+		return false, nil
+	}
+	if dynamic && implementsJSON(t) {
+		if tagged, err := searchTagged(t, map[reflect.Type]bool{}, false); err != nil || tagged {
+			if err == nil {
+				err = fmt.Errorf("jsonfield: type %s implements json.Marshaler or json.Unmarshaler and contains tagged fields", t)
+			}
+			return false, err
+		}
+		return false, nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return dynamic, nil
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return searchTagged(t.Elem(), visiting, dynamic)
+	case reflect.Struct:
+		fields, err := cachedFields(t)
+		if err != nil {
+			return false, err
+		}
+		for _, f := range fields {
+			if f.mode != "" {
+				return true, nil
+			}
+			if tagged, err := searchTagged(t.FieldByIndex(f.index).Type, visiting, dynamic); err != nil || tagged {
+				return tagged, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func implementsJSON(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(unmarshalerType) ||
+		reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// checkUntagged returns an error if the dynamic value v
+// contains a field with a "siv" tag.
+func checkUntagged(v reflect.Value) error {
+	if tagged, err := hasTaggedFields(v.Type()); err != nil || !tagged {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return checkUntagged(v.Elem())
+	case reflect.Struct:
+		fields, err := cachedFields(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if f.mode != "" {
+				return errInterface
+			}
+			if fv, ok := fieldByIndex(v, f.index, false); ok {
+				if err := checkUntagged(fv); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkUntagged(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := checkUntagged(iter.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
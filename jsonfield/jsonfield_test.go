@@ -0,0 +1,250 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package jsonfield
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Address struct {
+	City   string `json:"city"`
+	Street string `json:"street" siv:"random"`
+}
+
+type Base struct {
+	ID int `json:"id"`
+}
+
+type User struct {
+	Base
+	Name      string             `json:"name"`
+	Email     string             `json:"email" siv:"deterministic"`
+	SSN       string             `json:"ssn,omitempty" siv:"random"`
+	Tokens    []string           `json:"tokens" siv:"random"`
+	Address   *Address           `json:"address,omitempty"`
+	Previous  []Address          `json:"previous"`
+	Accounts  map[string]Address `json:"accounts"`
+	CreatedAt time.Time          `json:"created_at"`
+	Internal  string             `json:"-" siv:"random"`
+}
+
+var testKeys = Keys{Deterministic: make([]byte, 64), Random: make([]byte, 32)}
+
+var testUser = User{
+	Base:      Base{ID: 42},
+	Name:      "Alice",
+	Email:     "alice@example.com",
+	SSN:       "078-05-1120",
+	Tokens:    []string{"t1", "t2"},
+	Address:   &Address{City: "Berlin", Street: "Unter den Linden 1"},
+	Previous:  []Address{{City: "Munich", Street: "Marienplatz 8"}, {City: "Hamburg", Street: "Jungfernstieg 7"}},
+	Accounts:  map[string]Address{"work/main": {City: "Paris", Street: "Rue de Rivoli 99"}},
+	CreatedAt: time.Date(2018, 11, 6, 0, 0, 0, 0, time.UTC),
+}
+
+func TestCodec(t *testing.T) {
+	c, err := New(testKeys)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	data, err := c.Marshal(testUser)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	for _, secret := range []string{"alice@example.com", "078-05-1120", `"t1"`, "Unter den Linden", "Marienplatz", "Rue de Rivoli"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Fatalf("Marshal: plaintext %q found in %s", secret, data)
+		}
+	}
+	for _, public := range []string{`"id":42`, `"name":"Alice"`, `"city":"Berlin"`, `"city":"Paris"`, `"created_at":"2018-11-06T00:00:00Z"`} {
+		if !bytes.Contains(data, []byte(public)) {
+			t.Fatalf("Marshal: %s not found in %s", public, data)
+		}
+	}
+
+	var user User
+	if err = c.Unmarshal(data, &user); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(user, testUser) {
+		t.Fatalf("Unmarshal: got %+v - want %+v", user, testUser)
+	}
+
+	// Deterministic fields encrypt to the same value while
+	// random fields do not.
+	again, _ := c.Marshal(testUser)
+	var first, second map[string]json.RawMessage
+	json.Unmarshal(data, &first)
+	json.Unmarshal(again, &second)
+	if !bytes.Equal(first["email"], second["email"]) {
+		t.Fatal("Deterministic field is not deterministic")
+	}
+	if bytes.Equal(first["ssn"], second["ssn"]) {
+		t.Fatal("Random field is deterministic")
+	}
+
+	empty, _ := c.Marshal(User{})
+	if bytes.Contains(empty, []byte(`"ssn"`)) || bytes.Contains(empty, []byte(`"address"`)) {
+		t.Fatalf("Marshal: omitempty field found in %s", empty)
+	}
+}
+
+func TestCodecTampering(t *testing.T) {
+	c, _ := New(testKeys)
+	data, _ := c.Marshal(testUser)
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+
+	swap := func(modify func(doc map[string]interface{})) []byte {
+		var d map[string]interface{}
+		json.Unmarshal(data, &d)
+		modify(d)
+		b, _ := json.Marshal(d)
+		return b
+	}
+	tests := map[string][]byte{
+		"moved field": swap(func(d map[string]interface{}) { d["ssn"] = doc["email"] }),
+		"swapped elements": swap(func(d map[string]interface{}) {
+			p := d["previous"].([]interface{})
+			p[0].(map[string]interface{})["street"], p[1].(map[string]interface{})["street"] = p[1].(map[string]interface{})["street"], p[0].(map[string]interface{})["street"]
+		}),
+		"renamed map key": swap(func(d map[string]interface{}) {
+			a := d["accounts"].(map[string]interface{})
+			a["home"] = a["work/main"]
+			delete(a, "work/main")
+		}),
+		"plaintext field": swap(func(d map[string]interface{}) { d["email"] = "mallory@example.com" }),
+		"null field":      swap(func(d map[string]interface{}) { d["ssn"] = nil }),
+	}
+	for name, test := range tests {
+		var user User
+		if err := c.Unmarshal(test, &user); err == nil {
+			t.Fatalf("%s: Unmarshal succeeded", name)
+		}
+	}
+
+	other, _ := New(Keys{Deterministic: testKeys.Deterministic, Random: bytes.Repeat([]byte{1}, 32)})
+	var user User
+	if err := other.Unmarshal(data, &user); err == nil {
+		t.Fatal("Unmarshal succeeded with wrong key")
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	c, _ := New(Keys{Deterministic: testKeys.Deterministic})
+	if _, err := c.Marshal(testUser); err == nil {
+		t.Fatal("Marshal succeeded without random key")
+	}
+	if err := c.Unmarshal([]byte("{}"), User{}); err == nil {
+		t.Fatal("Unmarshal succeeded for non-pointer")
+	}
+
+	type invalid struct {
+		Field string `siv:"unknown"`
+	}
+	if _, err := c.Marshal(invalid{}); err == nil || !strings.Contains(err.Error(), "invalid siv tag") {
+		t.Fatalf("Marshal did not fail for invalid tag: %v", err)
+	}
+	if err := c.Unmarshal([]byte("{}"), &invalid{}); err == nil || !strings.Contains(err.Error(), "invalid siv tag") {
+		t.Fatalf("Unmarshal did not fail for invalid tag: %v", err)
+	}
+}
+
+type Inner struct {
+	SSN  string `json:"ssn"`
+	Note string
+}
+
+type Outer struct {
+	Inner
+	SSN string `json:"ssn" siv:"random"`
+}
+
+type Ambiguous struct {
+	Inner
+	Other
+}
+
+type Other struct {
+	Note string `siv:"random"`
+}
+
+func TestCodecEmbedded(t *testing.T) {
+	c, _ := New(testKeys)
+
+	outer := Outer{Inner: Inner{SSN: "inner", Note: "note"}, SSN: "outer-secret"}
+	data, err := c.Marshal(outer)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("outer-secret")) || bytes.Contains(data, []byte("inner")) {
+		t.Fatalf("Marshal: shadowed field found in %s", data)
+	}
+	var decoded Outer
+	if err = c.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if want := (Outer{Inner: Inner{Note: "note"}, SSN: "outer-secret"}); decoded != want {
+		t.Fatalf("Unmarshal: got %+v - want %+v", decoded, want)
+	}
+
+	// Conflicting fields at the same depth are dropped - like encoding/json does.
+	data, err = c.Marshal(Ambiguous{Inner: Inner{SSN: "ssn", Note: "a"}, Other: Other{Note: "b"}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"ssn":"ssn"}`; string(data) != want {
+		t.Fatalf("Marshal: got %s - want %s", data, want)
+	}
+}
+
+type Secret struct {
+	S string `json:"s" siv:"random"`
+}
+
+type marshalerSecret Secret
+
+func (s marshalerSecret) MarshalJSON() ([]byte, error) { return json.Marshal(Secret(s)) }
+
+func TestCodecFailClosed(t *testing.T) {
+	c, _ := New(testKeys)
+
+	type container struct {
+		Data interface{} `json:"data"`
+	}
+	for i, v := range []interface{}{
+		Secret{S: "leaked"},
+		&Secret{S: "leaked"},
+		[]interface{}{"public", Secret{S: "leaked"}},
+		map[string]interface{}{"address": Address{City: "Berlin", Street: "leaked"}},
+		marshalerSecret{S: "leaked"},
+	} {
+		if data, err := c.Marshal(container{Data: v}); err == nil {
+			t.Fatalf("Test %d: Marshal succeeded: %s", i, data)
+		}
+	}
+	if _, err := c.Marshal(struct {
+		S marshalerSecret `json:"s"`
+	}{}); err == nil {
+		t.Fatal("Marshal succeeded for json.Marshaler with tagged fields")
+	}
+
+	data, err := c.Marshal(container{Data: map[string]interface{}{"public": []string{"value"}}})
+	if err != nil {
+		t.Fatalf("Marshal failed for untagged interface value: %v", err)
+	}
+	if want := `{"data":{"public":["value"]}}`; string(data) != want {
+		t.Fatalf("Marshal: got %s - want %s", data, want)
+	}
+	var decoded container
+	if err = c.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package jwe
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// protectedHeader is the JOSE header produced by this package.
+type protectedHeader struct {
+	Algorithm  string `json:"alg,omitempty"`
+	Encryption string `json:"enc"`
+	KeyID      string `json:"kid,omitempty"`
+}
+
+// EncryptCompact encrypts the plaintext with a fresh content
+// encryption key using the enc algorithm, wraps the CEK with the
+// kek and returns the JWE compact serialization. The kek must be
+// 32, 48 or 64 bytes long. If keyID is not empty, it is added as
+// "kid" to the protected header.
+func EncryptCompact(kek []byte, keyID, enc string, plaintext []byte) (string, error) {
+	alg, err := keyWrapAlgorithm(kek)
+	if err != nil {
+		return "", err
+	}
+	cek, err := newCEK(enc)
+	if err != nil {
+		return "", err
+	}
+	encryptedKey, err := wrapKey(kek, cek)
+	if err != nil {
+		return "", err
+	}
+	h, err := json.Marshal(protectedHeader{Algorithm: alg, Encryption: enc, KeyID: keyID})
+	if err != nil {
+		return "", err
+	}
+	protected := encoding.EncodeToString(h)
+
+	iv, ciphertext, tag, err := encryptContent(enc, cek, plaintext, []byte(protected))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		protected,
+		encoding.EncodeToString(encryptedKey),
+		encoding.EncodeToString(iv),
+		encoding.EncodeToString(ciphertext),
+		encoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// DecryptCompact parses a JWE in compact serialization, unwraps
+// the content encryption key with the kek and returns the
+// decrypted plaintext.
+func DecryptCompact(kek []byte, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, errMalformed
+	}
+	var values [5][]byte
+	for i, part := range parts {
+		v, err := encoding.DecodeString(part)
+		if err != nil {
+			return nil, errMalformed
+		}
+		values[i] = v
+	}
+
+	h, err := parseHeader(values[0])
+	if err != nil {
+		return nil, err
+	}
+	alg, enc, err := h.validate()
+	if err != nil {
+		return nil, err
+	}
+	cek, err := unwrapKey(kek, alg, values[1])
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := cekSize(enc); len(cek) != n {
+		return nil, errDecrypt
+	}
+	return decryptContent(enc, cek, values[2], values[3], values[4], []byte(parts[0]))
+}
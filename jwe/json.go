@@ -0,0 +1,207 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package jwe
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Recipient is a JWE recipient identified by its key
+// encryption key and an optional key ID.
+type Recipient struct {
+	KEK   []byte
+	KeyID string
+}
+
+type jsonRecipient struct {
+	Header       json.RawMessage `json:"header,omitempty"`
+	EncryptedKey string          `json:"encrypted_key"`
+}
+
+type jsonJWE struct {
+	Protected   string          `json:"protected,omitempty"`
+	Unprotected json.RawMessage `json:"unprotected,omitempty"`
+
+	// General serialization
+	Recipients []jsonRecipient `json:"recipients,omitempty"`
+
+	// Flattened serialization
+	Header       json.RawMessage `json:"header,omitempty"`
+	EncryptedKey *string         `json:"encrypted_key,omitempty"`
+
+	AAD        string `json:"aad,omitempty"`
+	IV         string `json:"iv"`
+	Ciphertext string `json:"ciphertext"`
+	Tag        string `json:"tag"`
+}
+
+// EncryptJSON encrypts the plaintext with a fresh content
+// encryption key using the enc algorithm and returns the JWE
+// general JSON serialization. The CEK is wrapped for every
+// recipient. The additional data is authenticated but not
+// encrypted and is included as "aad" member.
+func EncryptJSON(recipients []Recipient, enc string, plaintext, additionalData []byte) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errMalformed
+	}
+	cek, err := newCEK(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwe jsonJWE
+	for _, r := range recipients {
+		alg, err := keyWrapAlgorithm(r.KEK)
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, err := wrapKey(r.KEK, cek)
+		if err != nil {
+			return nil, err
+		}
+		h, err := json.Marshal(struct {
+			Algorithm string `json:"alg"`
+			KeyID     string `json:"kid,omitempty"`
+		}{alg, r.KeyID})
+		if err != nil {
+			return nil, err
+		}
+		jwe.Recipients = append(jwe.Recipients, jsonRecipient{
+			Header:       h,
+			EncryptedKey: encoding.EncodeToString(encryptedKey),
+		})
+	}
+
+	h, err := json.Marshal(protectedHeader{Encryption: enc})
+	if err != nil {
+		return nil, err
+	}
+	jwe.Protected = encoding.EncodeToString(h)
+	if len(additionalData) > 0 {
+		jwe.AAD = encoding.EncodeToString(additionalData)
+	}
+
+	iv, ciphertext, tag, err := encryptContent(enc, cek, plaintext, jwe.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	jwe.IV = encoding.EncodeToString(iv)
+	jwe.Ciphertext = encoding.EncodeToString(ciphertext)
+	jwe.Tag = encoding.EncodeToString(tag)
+	return json.Marshal(jwe)
+}
+
+// DecryptJSON parses a JWE in general or flattened JSON
+// serialization, unwraps the content encryption key of the
+// first recipient that can be decrypted with the kek and
+// returns the decrypted plaintext and the additional data.
+func DecryptJSON(kek []byte, data []byte) (plaintext, additionalData []byte, err error) {
+	if _, err = parseHeader(data); err != nil { // reject duplicate members
+		return nil, nil, err
+	}
+	var jwe jsonJWE
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&jwe); err != nil {
+		return nil, nil, errMalformed
+	}
+
+	recipients := jwe.Recipients
+	if jwe.EncryptedKey != nil || len(jwe.Header) > 0 {
+		if len(recipients) > 0 || jwe.EncryptedKey == nil {
+			return nil, nil, errMalformed
+		}
+		recipients = []jsonRecipient{{Header: jwe.Header, EncryptedKey: *jwe.EncryptedKey}}
+	}
+	if len(recipients) == 0 {
+		return nil, nil, errMalformed
+	}
+
+	var protected, unprotected header
+	if jwe.Protected != "" {
+		raw, err := encoding.DecodeString(jwe.Protected)
+		if err != nil {
+			return nil, nil, errMalformed
+		}
+		if protected, err = parseHeader(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(jwe.Unprotected) > 0 {
+		if unprotected, err = parseHeader(jwe.Unprotected); err != nil {
+			return nil, nil, err
+		}
+	}
+	iv, err := encoding.DecodeString(jwe.IV)
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+	ciphertext, err := encoding.DecodeString(jwe.Ciphertext)
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+	tag, err := encoding.DecodeString(jwe.Tag)
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+	if additionalData, err = encoding.DecodeString(jwe.AAD); err != nil {
+		return nil, nil, errMalformed
+	}
+
+	// Validate all recipients before decrypting anything such that
+	// an unsupported critical parameter is never ignored.
+	type candidate struct {
+		alg, enc     string
+		encryptedKey []byte
+	}
+	candidates := make([]candidate, 0, len(recipients))
+	for _, r := range recipients {
+		var h header
+		if len(r.Header) > 0 {
+			if h, err = parseHeader(r.Header); err != nil {
+				return nil, nil, err
+			}
+		}
+		merged, err := merge(protected, unprotected, h)
+		if err != nil {
+			return nil, nil, err
+		}
+		alg, enc, err := merged.validate()
+		if err != nil {
+			return nil, nil, err
+		}
+		encryptedKey, err := encoding.DecodeString(r.EncryptedKey)
+		if err != nil {
+			return nil, nil, errMalformed
+		}
+		candidates = append(candidates, candidate{alg, enc, encryptedKey})
+	}
+
+	for _, c := range candidates {
+		cek, err := unwrapKey(kek, c.alg, c.encryptedKey)
+		if err != nil {
+			continue
+		}
+		if n, _ := cekSize(c.enc); len(cek) != n {
+			continue
+		}
+		plaintext, err = decryptContent(c.enc, cek, iv, ciphertext, tag, jwe.additionalData())
+		if err != nil {
+			return nil, nil, err
+		}
+		return plaintext, additionalData, nil
+	}
+	return nil, nil, errDecrypt
+}
+
+// additionalData returns the additional authenticated data
+// of the content encryption as specified by RFC 7516 Section 5.1.
+func (jwe *jsonJWE) additionalData() []byte {
+	if jwe.AAD == "" {
+		return []byte(jwe.Protected)
+	}
+	return []byte(jwe.Protected + "." + jwe.AAD)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package jwe implements JSON Web Encryption (JWE) as specified
+// in RFC 7516 using the misuse-resistant AEADs of the siv package.
+//
+// The content is encrypted with AES-GCM-SIV or AES-SIV-CMAC and
+// the content encryption key (CEK) is wrapped with the AES-SIV
+// deterministic key wrap (RFC 5297 Section 1.3.4). Neither the
+// content encryption nor the key wrap algorithms are registered
+// with IANA. Therefore, the "enc" and "alg" values of this package
+// are non-standard and only interoperate with implementations
+// using the same values:
+//
+//	enc         CEK size  content encryption
+//	A128GCMSIV  16 bytes  AES-128-GCM-SIV (siv.NewGCM)
+//	A256GCMSIV  32 bytes  AES-256-GCM-SIV (siv.NewGCM)
+//	A128SIV     32 bytes  AES-SIV-CMAC-256 (siv.NewCMAC)
+//	A192SIV     48 bytes  AES-SIV-CMAC-384 (siv.NewCMAC)
+//	A256SIV     64 bytes  AES-SIV-CMAC-512 (siv.NewCMAC)
+//
+//	alg         KEK size  key wrap
+//	A128SIVKW   32 bytes  AES-SIV-CMAC-256 with empty nonce
+//	A192SIVKW   48 bytes  AES-SIV-CMAC-384 with empty nonce
+//	A256SIVKW   64 bytes  AES-SIV-CMAC-512 with empty nonce
+//
+// The parser is strict: it rejects unknown "alg" and "enc" values,
+// compressed content ("zip"), any critical header parameter ("crit"),
+// duplicate header parameters and non-canonical base64url encodings.
+package jwe
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// Content encryption algorithms - the JWE "enc" values.
+const (
+	A128GCMSIV = "A128GCMSIV"
+	A256GCMSIV = "A256GCMSIV"
+	A128SIV    = "A128SIV"
+	A192SIV    = "A192SIV"
+	A256SIV    = "A256SIV"
+)
+
+// Key wrap algorithms - the JWE "alg" values.
+const (
+	A128SIVKW = "A128SIVKW"
+	A192SIVKW = "A192SIVKW"
+	A256SIVKW = "A256SIVKW"
+)
+
+var (
+	errDecrypt   = errors.New("jwe: decryption failed")
+	errMalformed = errors.New("jwe: malformed JWE")
+	errAlgorithm = errors.New("jwe: unsupported algorithm")
+	errCritical  = errors.New("jwe: unsupported critical header parameter")
+	errZip       = errors.New("jwe: compressed content is not supported")
+	errDuplicate = errors.New("jwe: duplicate header parameter")
+	errKEKSize   = errors.New("jwe: invalid key encryption key size")
+)
+
+var encoding = base64.RawURLEncoding.Strict()
+
+// keyWrapAlgorithm returns the "alg" value for a KEK.
+func keyWrapAlgorithm(kek []byte) (string, error) {
+	switch len(kek) {
+	case 32:
+		return A128SIVKW, nil
+	case 48:
+		return A192SIVKW, nil
+	case 64:
+		return A256SIVKW, nil
+	default:
+		return "", errKEKSize
+	}
+}
+
+// cekSize returns the size of the CEK for an "enc" value.
+func cekSize(enc string) (int, error) {
+	switch enc {
+	case A128GCMSIV:
+		return 16, nil
+	case A256GCMSIV:
+		return 32, nil
+	case A128SIV:
+		return 32, nil
+	case A192SIV:
+		return 48, nil
+	case A256SIV:
+		return 64, nil
+	default:
+		return 0, errAlgorithm
+	}
+}
+
+func newContentCipher(enc string, cek []byte) (cipher.AEAD, error) {
+	switch enc {
+	case A128GCMSIV, A256GCMSIV:
+		return siv.NewGCM(cek)
+	case A128SIV, A192SIV, A256SIV:
+		return siv.NewCMAC(cek)
+	default:
+		return nil, errAlgorithm
+	}
+}
+
+// wrapKey wraps the CEK using the AES-SIV deterministic key wrap.
+func wrapKey(kek, cek []byte) ([]byte, error) {
+	c, err := siv.NewCMAC(kek)
+	if err != nil {
+		return nil, err
+	}
+	return c.Seal(nil, nil, cek, nil), nil
+}
+
+// unwrapKey unwraps the CEK for the given "alg" value.
+func unwrapKey(kek []byte, alg string, encryptedKey []byte) ([]byte, error) {
+	if a, err := keyWrapAlgorithm(kek); err != nil || a != alg {
+		return nil, errDecrypt
+	}
+	c, err := siv.NewCMAC(kek)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := c.Open(nil, nil, encryptedKey, nil)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return cek, nil
+}
+
+// encryptContent generates a random IV and encrypts the plaintext.
+// It returns the IV, the ciphertext and the authentication tag.
+func encryptContent(enc string, cek, plaintext, additionalData []byte) (iv, ciphertext, tag []byte, err error) {
+	c, err := newContentCipher(enc, cek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv = make([]byte, c.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, nil, err
+	}
+	sealed := c.Seal(nil, iv, plaintext, additionalData)
+	if isCMAC(enc) { // AES-SIV-CMAC prepends the tag
+		return iv, sealed[c.Overhead():], sealed[:c.Overhead()], nil
+	}
+	n := len(sealed) - c.Overhead()
+	return iv, sealed[:n], sealed[n:], nil
+}
+
+func decryptContent(enc string, cek, iv, ciphertext, tag, additionalData []byte) ([]byte, error) {
+	c, err := newContentCipher(enc, cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != c.NonceSize() || len(tag) != c.Overhead() {
+		return nil, errMalformed
+	}
+	var sealed []byte
+	if isCMAC(enc) {
+		sealed = append(append(sealed, tag...), ciphertext...)
+	} else {
+		sealed = append(append(sealed, ciphertext...), tag...)
+	}
+	plaintext, err := c.Open(nil, iv, sealed, additionalData)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plaintext, nil
+}
+
+func isCMAC(enc string) bool { return enc == A128SIV || enc == A192SIV || enc == A256SIV }
+
+func newCEK(enc string) ([]byte, error) {
+	n, err := cekSize(enc)
+	if err != nil {
+		return nil, err
+	}
+	cek := make([]byte, n)
+	if _, err = io.ReadFull(rand.Reader, cek); err != nil {
+		return nil, err
+	}
+	return cek, nil
+}
+
+// header is a parsed JOSE header. It keeps the raw JSON
+// values of all header parameters.
+type header map[string]json.RawMessage
+
+// parseHeader parses a JSON object and rejects duplicate
+// member names.
+func parseHeader(data []byte) (header, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errMalformed
+	}
+	h := header{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, errMalformed
+		}
+		name, ok := t.(string)
+		if !ok {
+			return nil, errMalformed
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, errMalformed
+		}
+		if _, ok = h[name]; ok {
+			return nil, errDuplicate
+		}
+		h[name] = value
+	}
+	if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+		return nil, errMalformed
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errMalformed
+	}
+	return h, nil
+}
+
+// merge returns the union of the given headers. It
+// rejects parameters present in more than one header.
+func merge(headers ...header) (header, error) {
+	m := header{}
+	for _, h := range headers {
+		for name, value := range h {
+			if _, ok := m[name]; ok {
+				return nil, errDuplicate
+			}
+			m[name] = value
+		}
+	}
+	return m, nil
+}
+
+// validate checks that the (merged) header only contains
+// parameters this package understands and returns the
+// "alg" and "enc" values.
+func (h header) validate() (alg, enc string, err error) {
+	if _, ok := h["crit"]; ok {
+		return "", "", errCritical
+	}
+	if _, ok := h["zip"]; ok {
+		return "", "", errZip
+	}
+	if err = h.get("alg", &alg); err != nil {
+		return "", "", err
+	}
+	if err = h.get("enc", &enc); err != nil {
+		return "", "", err
+	}
+	if alg != A128SIVKW && alg != A192SIVKW && alg != A256SIVKW {
+		return "", "", errAlgorithm
+	}
+	if _, err = cekSize(enc); err != nil {
+		return "", "", err
+	}
+	return alg, enc, nil
+}
+
+func (h header) get(name string, v *string) error {
+	raw, ok := h[name]
+	if !ok {
+		return errMalformed
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return errMalformed
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package jwe
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var encAlgorithms = []string{A128GCMSIV, A256GCMSIV, A128SIV, A192SIV, A256SIV}
+
+func TestCompact(t *testing.T) {
+	plaintext := []byte("The true sign of intelligence is not knowledge but imagination.")
+	for _, size := range []int{32, 48, 64} {
+		kek := bytes.Repeat([]byte{byte(size)}, size)
+		for _, enc := range encAlgorithms {
+			token, err := EncryptCompact(kek, "key-1", enc, plaintext)
+			if err != nil {
+				t.Fatalf("%d/%s: EncryptCompact failed: %v", size, enc, err)
+			}
+			p, err := DecryptCompact(kek, token)
+			if err != nil {
+				t.Fatalf("%d/%s: DecryptCompact failed: %v", size, enc, err)
+			}
+			if !bytes.Equal(p, plaintext) {
+				t.Fatalf("%d/%s: plaintext mismatch", size, enc)
+			}
+
+			otherKEK := bytes.Repeat([]byte{0xff}, size)
+			if _, err = DecryptCompact(otherKEK, token); err == nil {
+				t.Fatalf("%d/%s: DecryptCompact succeeded with wrong KEK", size, enc)
+			}
+			parts := strings.Split(token, ".")
+			parts[3] = encoding.EncodeToString(append(mustDecode(t, parts[3]), 0))
+			if _, err = DecryptCompact(kek, strings.Join(parts, ".")); err == nil {
+				t.Fatalf("%d/%s: DecryptCompact succeeded for modified ciphertext", size, enc)
+			}
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	recipients := []Recipient{
+		{KEK: bytes.Repeat([]byte{1}, 32), KeyID: "alice"},
+		{KEK: bytes.Repeat([]byte{2}, 64), KeyID: "bob"},
+	}
+	plaintext, additionalData := []byte("plaintext"), []byte("additional data")
+	for _, enc := range encAlgorithms {
+		data, err := EncryptJSON(recipients, enc, plaintext, additionalData)
+		if err != nil {
+			t.Fatalf("%s: EncryptJSON failed: %v", enc, err)
+		}
+		for _, r := range recipients {
+			p, aad, err := DecryptJSON(r.KEK, data)
+			if err != nil {
+				t.Fatalf("%s/%s: DecryptJSON failed: %v", enc, r.KeyID, err)
+			}
+			if !bytes.Equal(p, plaintext) || !bytes.Equal(aad, additionalData) {
+				t.Fatalf("%s/%s: plaintext or additional data mismatch", enc, r.KeyID)
+			}
+		}
+
+		var jwe jsonJWE
+		if err = json.Unmarshal(data, &jwe); err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		jwe.AAD = encoding.EncodeToString([]byte("other data"))
+		modified, _ := json.Marshal(jwe)
+		if _, _, err = DecryptJSON(recipients[0].KEK, modified); err == nil {
+			t.Fatalf("%s: DecryptJSON succeeded for modified additional data", enc)
+		}
+
+		// Flattened serialization
+		encryptedKey := jwe.Recipients[1].EncryptedKey
+		jwe.AAD = encoding.EncodeToString(additionalData)
+		jwe.Header, jwe.EncryptedKey, jwe.Recipients = jwe.Recipients[1].Header, &encryptedKey, nil
+		flattened, _ := json.Marshal(jwe)
+		if p, _, err := DecryptJSON(recipients[1].KEK, flattened); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("%s: DecryptJSON failed for flattened serialization: %v", enc, err)
+		}
+	}
+}
+
+var strictHeaderTests = []struct {
+	header string
+	err    error
+}{
+	{header: `{"alg":"A128SIVKW","enc":"A128GCMSIV","crit":["exp"],"exp":1}`, err: errCritical},
+	{header: `{"alg":"A128SIVKW","enc":"A128GCMSIV","zip":"DEF"}`, err: errZip},
+	{header: `{"alg":"A128SIVKW","enc":"A128GCMSIV","alg":"A128SIVKW"}`, err: errDuplicate},
+	{header: `{"alg":"A128KW","enc":"A128GCMSIV"}`, err: errAlgorithm},
+	{header: `{"alg":"A128SIVKW","enc":"A128GCM"}`, err: errAlgorithm},
+	{header: `{"alg":"A128SIVKW"}`, err: errMalformed},
+	{header: `{"alg":"A128SIVKW","enc":"A128GCMSIV"}{}`, err: errMalformed},
+}
+
+func TestStrictHeader(t *testing.T) {
+	kek := make([]byte, 32)
+	token, err := EncryptCompact(kek, "", A128GCMSIV, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("EncryptCompact failed: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	for i, test := range strictHeaderTests {
+		parts[0] = encoding.EncodeToString([]byte(test.header))
+		if _, err := DecryptCompact(kek, strings.Join(parts, ".")); err != test.err {
+			t.Errorf("Test %d: got error %v - want %v", i, err, test.err)
+		}
+	}
+
+	// A critical parameter in a per-recipient header must
+	// be rejected as well.
+	data, err := EncryptJSON([]Recipient{{KEK: kek}}, A128GCMSIV, []byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("EncryptJSON failed: %v", err)
+	}
+	var jwe jsonJWE
+	json.Unmarshal(data, &jwe)
+	jwe.Recipients[0].Header = json.RawMessage(`{"alg":"A128SIVKW","crit":["b64"],"b64":false}`)
+	data, _ = json.Marshal(jwe)
+	if _, _, err = DecryptJSON(kek, data); err != errCritical {
+		t.Fatalf("got error %v - want %v", err, errCritical)
+	}
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	v, err := encoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm identifies an AEAD algorithm and key size.
+type Algorithm byte
+
+// The supported algorithms. The AES-SIV algorithms use AES-SIV-CMAC
+// (RFC 5297) with a key twice as large as the AES key - e.g.
+// AES128SIV corresponds to AEAD_AES_SIV_CMAC_256.
+const (
+	AES128GCMSIV Algorithm = 1 // AES-GCM-SIV with a 16 byte key
+	AES256GCMSIV Algorithm = 2 // AES-GCM-SIV with a 32 byte key
+	AES128SIV    Algorithm = 3 // AES-SIV-CMAC with a 32 byte key
+	AES192SIV    Algorithm = 4 // AES-SIV-CMAC with a 48 byte key
+	AES256SIV    Algorithm = 5 // AES-SIV-CMAC with a 64 byte key
+)
+
+// algorithmInfo describes an algorithm of the registry.
+type algorithmInfo struct {
+	name      string
+	keySize   int
+	nonceSize int
+	newAEAD   func(key []byte) (cipher.AEAD, error)
+}
+
+// algorithms is the algorithm registry. It is the single source of
+// the algorithm IDs, names and parameters used by keys, envelopes
+// and the siv command.
+var algorithms = []Algorithm{AES128GCMSIV, AES256GCMSIV, AES128SIV, AES192SIV, AES256SIV}
+
+var algorithmInfos = map[Algorithm]algorithmInfo{
+	AES128GCMSIV: {"AES-128-GCM-SIV", 16, 12, NewGCM},
+	AES256GCMSIV: {"AES-256-GCM-SIV", 32, 12, NewGCM},
+	AES128SIV:    {"AES-128-SIV", 32, 16, NewCMAC},
+	AES192SIV:    {"AES-192-SIV", 48, 16, NewCMAC},
+	AES256SIV:    {"AES-256-SIV", 64, 16, NewCMAC},
+}
+
+// Algorithms returns all supported algorithms.
+func Algorithms() []Algorithm { return append([]Algorithm(nil), algorithms...) }
+
+// ParseAlgorithm returns the algorithm with the given name.
+// The name is case-insensitive.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for _, a := range algorithms {
+		if strings.EqualFold(name, algorithmInfos[a].name) {
+			return a, nil
+		}
+	}
+	return 0, errUnknownAlgorithm
+}
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	if info, ok := algorithmInfos[a]; ok {
+		return info.name
+	}
+	return "Algorithm(" + strconv.Itoa(int(a)) + ")"
+}
+
+// KeySize returns the key size of the algorithm in bytes
+// or 0 if the algorithm is unknown.
+func (a Algorithm) KeySize() int { return algorithmInfos[a].keySize }
+
+// NonceSize returns the nonce size of the algorithm in bytes
+// or 0 if the algorithm is unknown.
+func (a Algorithm) NonceSize() int { return algorithmInfos[a].nonceSize }
+
+const (
+	keyVersion        = 1
+	keyCheckValueSize = 4
+	pemKeyType        = "SIV KEY"
+)
+
+var keyMagic = [4]byte{'S', 'I', 'V', 'K'}
+
+var (
+	errUnknownAlgorithm = errors.New("siv: unknown algorithm")
+	errKeyFormat        = errors.New("siv: invalid key encoding")
+	errKeyCheckValue    = errors.New("siv: key check value mismatch")
+)
+
+// Key is a secret key bound to an algorithm.
+//
+// Its binary encoding is:
+//
+//	magic "SIVK" (4 bytes) || version (1 byte) || algorithm (1 byte) ||
+//	key ID (4 bytes, big-endian) || creation time (8 bytes, big-endian
+//	Unix seconds) || key length (1 byte) || key || check value (4 bytes)
+//
+// The check value detects corrupted keys and keys used with the
+// wrong algorithm without revealing the key.
+type Key struct {
+	alg     Algorithm
+	id      uint32
+	created time.Time
+	key     []byte
+}
+
+// GenerateKey returns a new random key for the algorithm
+// with a random key ID.
+func GenerateKey(alg Algorithm) (*Key, error) {
+	if alg.KeySize() == 0 {
+		return nil, errUnknownAlgorithm
+	}
+	key := make([]byte, alg.KeySize())
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	var id [4]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return nil, err
+	}
+	return &Key{
+		alg:     alg,
+		id:      binary.BigEndian.Uint32(id[:]),
+		created: time.Now().Truncate(time.Second),
+		key:     key,
+	}, nil
+}
+
+// NewKey returns a Key for the algorithm using the given key
+// bytes, key ID and creation time. The key must be exactly
+// alg.KeySize() bytes long.
+func NewKey(alg Algorithm, key []byte, id uint32, created time.Time) (*Key, error) {
+	if alg.KeySize() == 0 {
+		return nil, errUnknownAlgorithm
+	}
+	if len(key) != alg.KeySize() {
+		return nil, fmt.Errorf("siv: invalid key size %d for %v", len(key), alg)
+	}
+	return &Key{
+		alg:     alg,
+		id:      id,
+		created: created.Truncate(time.Second),
+		key:     append([]byte(nil), key...),
+	}, nil
+}
+
+// Algorithm returns the algorithm of the key.
+func (k *Key) Algorithm() Algorithm { return k.alg }
+
+// ID returns the key ID.
+func (k *Key) ID() uint32 { return k.id }
+
+// Created returns the creation time of the key.
+func (k *Key) Created() time.Time { return k.created }
+
+// AEAD returns a cipher.AEAD implementing the key's algorithm.
+func (k *Key) AEAD() (cipher.AEAD, error) {
+	info, ok := algorithmInfos[k.alg]
+	if !ok {
+		return nil, errUnknownAlgorithm
+	}
+	return info.newAEAD(k.key)
+}
+
+// CheckValue returns the key check value. It is the first 4 bytes
+// of the SHA-256 hash of 16 zero bytes sealed with an all-zero nonce
+// and the additional data "siv-go key check value". Hashing the
+// entire ciphertext ensures that every key byte affects the check
+// value - including the CTR key of AES-SIV-CMAC.
+func (k *Key) CheckValue() []byte {
+	aead, err := k.AEAD()
+	if err != nil {
+		return nil
+	}
+	ciphertext := aead.Seal(nil, make([]byte, aead.NonceSize()), make([]byte, 16), []byte("siv-go key check value"))
+	sum := sha256.Sum256(ciphertext)
+	return sum[:keyCheckValueSize]
+}
+
+// MarshalBinary returns the binary encoding of the key.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	if k.alg.KeySize() == 0 {
+		return nil, errUnknownAlgorithm
+	}
+	b := make([]byte, 0, 19+len(k.key)+keyCheckValueSize)
+	b = append(b, keyMagic[:]...)
+	b = append(b, keyVersion, byte(k.alg))
+	b = append(b, make([]byte, 12)...)
+	binary.BigEndian.PutUint32(b[6:], k.id)
+	binary.BigEndian.PutUint64(b[10:], uint64(k.created.Unix()))
+	b = append(b, byte(len(k.key)))
+	b = append(b, k.key...)
+	return append(b, k.CheckValue()...), nil
+}
+
+// UnmarshalBinary decodes a key from its binary encoding.
+// It returns an error if the check value does not match.
+func (k *Key) UnmarshalBinary(data []byte) error {
+	if len(data) < 19 || !bytes.Equal(data[:4], keyMagic[:]) || data[4] != keyVersion {
+		return errKeyFormat
+	}
+	alg := Algorithm(data[5])
+	if alg.KeySize() == 0 {
+		return errUnknownAlgorithm
+	}
+	if int(data[18]) != alg.KeySize() || len(data) != 19+alg.KeySize()+keyCheckValueSize {
+		return errKeyFormat
+	}
+	key := &Key{
+		alg:     alg,
+		id:      binary.BigEndian.Uint32(data[6:]),
+		created: time.Unix(int64(binary.BigEndian.Uint64(data[10:])), 0),
+		key:     append([]byte(nil), data[19:19+alg.KeySize()]...),
+	}
+	if subtle.ConstantTimeCompare(key.CheckValue(), data[len(data)-keyCheckValueSize:]) != 1 {
+		return errKeyCheckValue
+	}
+	*k = *key
+	return nil
+}
+
+// MarshalPEM returns the PEM encoding of the key using the block
+// type "SIV KEY". The algorithm, key ID and check value are added
+// as informational PEM headers.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	b, err := k.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemKeyType,
+		Headers: map[string]string{
+			"Algorithm":   k.alg.String(),
+			"Key-ID":      strconv.FormatUint(uint64(k.id), 10),
+			"Check-Value": hex.EncodeToString(k.CheckValue()),
+		},
+		Bytes: b,
+	}), nil
+}
+
+// ParsePEMKey parses the first "SIV KEY" PEM block of data.
+// The PEM headers are ignored.
+func ParsePEMKey(data []byte) (*Key, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("siv: no SIV KEY PEM block found")
+		}
+		if block.Type != pemKeyType {
+			continue
+		}
+		k := new(Key)
+		if err := k.UnmarshalBinary(block.Bytes); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var keyAlgorithms = []Algorithm{AES128GCMSIV, AES256GCMSIV, AES128SIV, AES192SIV, AES256SIV}
+
+func TestKey(t *testing.T) {
+	for i, alg := range keyAlgorithms {
+		key, err := GenerateKey(alg)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to generate %v key: %v", i, alg, err)
+		}
+		b, err := key.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Test %d: MarshalBinary failed: %v", i, err)
+		}
+		var parsed Key
+		if err = parsed.UnmarshalBinary(b); err != nil {
+			t.Fatalf("Test %d: UnmarshalBinary failed: %v", i, err)
+		}
+		if parsed.Algorithm() != alg || parsed.ID() != key.ID() || !parsed.Created().Equal(key.Created()) || !bytes.Equal(parsed.key, key.key) {
+			t.Fatalf("Test %d: key mismatch", i)
+		}
+
+		p, err := key.MarshalPEM()
+		if err != nil {
+			t.Fatalf("Test %d: MarshalPEM failed: %v", i, err)
+		}
+		if !strings.HasPrefix(string(p), "-----BEGIN SIV KEY-----") || !strings.Contains(string(p), alg.String()) {
+			t.Fatalf("Test %d: invalid PEM encoding: %s", i, p)
+		}
+		pemKey, err := ParsePEMKey(append([]byte("-----BEGIN OTHER-----\n-----END OTHER-----\n"), p...))
+		if err != nil {
+			t.Fatalf("Test %d: ParsePEMKey failed: %v", i, err)
+		}
+		if !bytes.Equal(pemKey.CheckValue(), key.CheckValue()) {
+			t.Fatalf("Test %d: check value mismatch", i)
+		}
+
+		aead, err := pemKey.AEAD()
+		if err != nil {
+			t.Fatalf("Test %d: AEAD failed: %v", i, err)
+		}
+		if aead.NonceSize() != alg.NonceSize() || len(key.key) != alg.KeySize() {
+			t.Fatalf("Test %d: AEAD of wrong algorithm", i)
+		}
+
+		b[len(b)-keyCheckValueSize-1] ^= 1 // modify the key
+		if err = parsed.UnmarshalBinary(b); err != errKeyCheckValue {
+			t.Fatalf("Test %d: UnmarshalBinary of modified key: got %v - want %v", i, err, errKeyCheckValue)
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for i, alg := range Algorithms() {
+		for _, name := range []string{alg.String(), strings.ToLower(alg.String())} {
+			if a, err := ParseAlgorithm(name); err != nil || a != alg {
+				t.Fatalf("Test %d: ParseAlgorithm(%q): got %v, %v - want %v", i, name, a, err, alg)
+			}
+		}
+	}
+	if _, err := ParseAlgorithm("AES-512-GCM"); err != errUnknownAlgorithm {
+		t.Fatalf("ParseAlgorithm: got %v - want %v", err, errUnknownAlgorithm)
+	}
+	if a := Algorithm(0); a.KeySize() != 0 || a.NonceSize() != 0 || a.String() != "Algorithm(0)" {
+		t.Fatalf("Unknown algorithm has parameters: %v %d %d", a, a.KeySize(), a.NonceSize())
+	}
+}
+
+func TestKeyAlgorithmMixup(t *testing.T) {
+	// A 32 byte key is valid for AES-256-GCM-SIV and AES-128-SIV.
+	// Changing the algorithm of an encoded key must be detected.
+	key, err := NewKey(AES256GCMSIV, make([]byte, 32), 1, time.Unix(1541462400, 0))
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	b, _ := key.MarshalBinary()
+	want := mustDecode("5349564b010200000001000000005be0d98020" +
+		"0000000000000000000000000000000000000000000000000000000000000000" + "1a57d550")
+	if !bytes.Equal(b, want) {
+		t.Fatalf("MarshalBinary: got %x - want %x", b, want)
+	}
+	b[5] = byte(AES128SIV)
+	var parsed Key
+	if err = parsed.UnmarshalBinary(b); err != errKeyCheckValue {
+		t.Fatalf("UnmarshalBinary: got %v - want %v", err, errKeyCheckValue)
+	}
+
+	if _, err = NewKey(AES128GCMSIV, make([]byte, 32), 1, time.Now()); err == nil {
+		t.Fatal("NewKey accepted a key of wrong size")
+	}
+	if _, err = GenerateKey(Algorithm(0)); err == nil {
+		t.Fatal("GenerateKey accepted an unknown algorithm")
+	}
+}
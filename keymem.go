@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+var secureMemory int32
+
+// SetSecureMemory enables or disables the secure-memory allocator
+// for AEADs created afterwards. It does not affect existing AEADs.
+//
+// If enabled, NewCMAC, NewCMACFromBlocks, NewGCM and
+// NewGCMSIVFromBlock place the key material they own - i.e. the
+// AES key schedules of all backends and the CMAC subkeys - in
+// dedicated memory pages which are:
+//
+//   - surrounded by inaccessible guard pages,
+//   - locked into RAM (mlock) such that they are never swapped,
+//   - excluded from core dumps (MADV_DONTDUMP) and
+//   - read-only once the key schedules have been computed.
+//
+// The pages are wiped and released by Destroy or - at the latest -
+// when the AEAD is garbage collected. The constructors return an
+// error if the pages cannot be allocated or locked - e.g. because
+// RLIMIT_MEMLOCK is exceeded.
+//
+// Block ciphers passed to NewCMACFromBlocks or NewGCMSIVFromBlock
+// and per-message keys live on the Go heap resp. stack and are not
+// affected.
+//
+// Secure memory is only supported on Linux. On other platforms
+// SetSecureMemory is a no-op.
+func SetSecureMemory(enabled bool) {
+	if enabled && secureMemorySupported {
+		atomic.StoreInt32(&secureMemory, 1)
+	} else {
+		atomic.StoreInt32(&secureMemory, 0)
+	}
+}
+
+// SecureMemory reports whether the secure-memory
+// allocator is enabled. It always returns false on
+// platforms that do not support secure memory.
+func SecureMemory() bool { return atomic.LoadInt32(&secureMemory) == 1 }
+
+// keyBuffer holds key material. It is either allocated on
+// the Go heap or - if secure memory is enabled - in locked
+// memory pages surrounded by guard pages.
+type keyBuffer struct {
+	data    []byte
+	mapping []byte // The entire memory mapping or nil if data lives on the Go heap
+}
+
+// newKeyBuffer returns a keyBuffer of n bytes. If secure is
+// true and secure memory is enabled, it allocates the buffer
+// in secure memory. Short-lived buffers - e.g. per-message
+// keys - should not use secure memory since allocating secure
+// memory is expensive.
+func newKeyBuffer(n int, secure bool) (*keyBuffer, error) {
+	if !secure || !SecureMemory() {
+		return &keyBuffer{data: make([]byte, n)}, nil
+	}
+	b, err := allocSecure(n)
+	if err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(b, (*keyBuffer).free)
+	return b, nil
+}
+
+// protect makes the buffer read-only.
+func (b *keyBuffer) protect() error {
+	if b.mapping == nil {
+		return nil
+	}
+	return protectSecure(b)
+}
+
+// free wipes the buffer and releases secure memory.
+// The buffer must not be used afterwards.
+func (b *keyBuffer) free() {
+	if b.mapping == nil {
+		wipe(b.data)
+		return
+	}
+	freeSecure(b)
+	b.data, b.mapping = nil, nil
+	runtime.SetFinalizer(b, nil)
+}
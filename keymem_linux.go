@@ -0,0 +1,59 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const secureMemorySupported = true
+
+// allocSecure maps n bytes - rounded up to whole pages -
+// between two guard pages. The data pages are locked into
+// RAM and excluded from core dumps.
+func allocSecure(n int) (*keyBuffer, error) {
+	pageSize := os.Getpagesize()
+	size := (n + pageSize - 1) / pageSize * pageSize
+	mapping, err := unix.Mmap(-1, 0, size+2*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	pages := mapping[pageSize : pageSize+size]
+	if err = unix.Mprotect(mapping[:pageSize], unix.PROT_NONE); err == nil {
+		err = unix.Mprotect(mapping[pageSize+size:], unix.PROT_NONE)
+	}
+	if err == nil {
+		err = unix.Mlock(pages)
+	}
+	if err == nil {
+		err = unix.Madvise(pages, unix.MADV_DONTDUMP)
+	}
+	if err != nil {
+		unix.Munmap(mapping)
+		return nil, err
+	}
+	return &keyBuffer{data: pages[:n:n], mapping: mapping}, nil
+}
+
+func protectSecure(b *keyBuffer) error {
+	pageSize := os.Getpagesize()
+	return unix.Mprotect(b.mapping[pageSize:len(b.mapping)-pageSize], unix.PROT_READ)
+}
+
+// freeSecure wipes and unmaps the pages of b. It may run on the
+// finalizer goroutine and, therefore, must not panic. If the pages
+// cannot be made writable they are unmapped without being wiped.
+// The kernel never hands out unmapped pages without zeroing them.
+func freeSecure(b *keyBuffer) {
+	pageSize := os.Getpagesize()
+	pages := b.mapping[pageSize : len(b.mapping)-pageSize]
+	if err := unix.Mprotect(pages, unix.PROT_READ|unix.PROT_WRITE); err == nil {
+		wipe(pages)
+	}
+	unix.Munlock(pages)
+	unix.Munmap(b.mapping)
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package siv
+
+import "errors"
+
+const secureMemorySupported = false
+
+var errSecureMemory = errors.New("siv: secure memory is not supported")
+
+func allocSecure(n int) (*keyBuffer, error) { return nil, errSecureMemory }
+
+func protectSecure(b *keyBuffer) error { return errSecureMemory }
+
+func freeSecure(b *keyBuffer) {}
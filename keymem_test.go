@@ -0,0 +1,76 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestSecureMemory(t *testing.T) {
+	SetSecureMemory(true)
+	defer SetSecureMemory(false)
+	if !SecureMemory() {
+		t.Skip("Secure memory is not supported")
+	}
+	testBackends(t, testSecureMemory)
+}
+
+func testSecureMemory(t *testing.T) {
+	for i, newAEAD := range []func([]byte) (cipher.AEAD, error){NewCMAC, NewGCM} {
+		c, err := newAEAD(make([]byte, 32))
+		if err != nil {
+			t.Skipf("Test %d: Failed to allocate secure memory: %v", i, err)
+		}
+		nonce := make([]byte, c.NonceSize())
+		ciphertext := c.Seal(nil, nonce, []byte("plaintext"), nil)
+		if plaintext, err := c.Open(nil, nonce, ciphertext, nil); err != nil || !bytes.Equal(plaintext, []byte("plaintext")) {
+			t.Fatalf("Test %d: Open failed: %v", i, err)
+		}
+
+		var mem *keyBuffer
+		switch c := c.(type) {
+		case *aesSivCMac:
+			mem = keyMemory(c.aead)
+		case *aesGcmSiv:
+			mem = keyMemory(c.aead)
+		}
+		if mem != nil {
+			if mem.mapping == nil {
+				t.Fatalf("Test %d: key material is not stored in secure memory", i)
+			}
+			if !faults(func() { mem.data[0] ^= 1 }) {
+				t.Fatalf("Test %d: key material is writeable", i)
+			}
+			if !faults(func() { faultSink = mem.mapping[0] }) {
+				t.Fatalf("Test %d: guard page is accessible", i)
+			}
+		}
+		c.(Destroyer).Destroy()
+	}
+}
+
+// keyMemory returns the keyBuffer of the backend
+// or nil if the backend does not own a keyBuffer.
+func keyMemory(c aead) *keyBuffer {
+	v := reflect.ValueOf(c).Elem().FieldByName("mem")
+	if !v.IsValid() {
+		return nil
+	}
+	return (*keyBuffer)(v.UnsafePointer())
+}
+
+var faultSink byte
+
+// faults reports whether f causes a memory fault.
+func faults(f func()) (fault bool) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() { fault = recover() != nil }()
+	f()
+	return false
+}
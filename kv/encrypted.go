@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package kv
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+const nonceSize = 12
+
+var errValue = errors.New("kv: invalid encrypted value")
+
+// Keys contains the keys used by an encrypted store.
+type Keys struct {
+	// Key encrypts the lookup keys using AES-SIV-CMAC.
+	// It must be either 32, 48 or 64 bytes long.
+	Key []byte
+
+	// Value encrypts the values using AES-GCM-SIV.
+	// It must be either 16 or 32 bytes long.
+	Value []byte
+}
+
+type encrypted struct {
+	store Store
+	key   cipher.AEAD
+	value cipher.AEAD
+}
+
+// Encrypted returns a Store that encrypts all keys and values
+// before passing them to store.
+//
+// A key is encrypted deterministically such that the same key
+// always maps to the same encrypted key. An encrypted value is
+// stored as:
+//
+//	nonce (12 bytes) || ciphertext || tag (16 bytes)
+//
+// The encrypted key is the additional data of the value. The
+// returned Store iterates in the order of the encrypted keys.
+func Encrypted(store Store, keys Keys) (Store, error) {
+	key, err := siv.NewCMAC(keys.Key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := siv.NewGCM(keys.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted{store: store, key: key, value: value}, nil
+}
+
+func (s *encrypted) Get(key []byte) ([]byte, error) {
+	encKey := s.key.Seal(nil, nil, key, nil)
+	encValue, err := s.store.Get(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.openValue(encKey, encValue)
+}
+
+func (s *encrypted) Put(key, value []byte) error {
+	encKey := s.key.Seal(nil, nil, key, nil)
+	encValue := make([]byte, nonceSize, nonceSize+len(value)+s.value.Overhead())
+	if _, err := io.ReadFull(rand.Reader, encValue); err != nil {
+		return err
+	}
+	encValue = s.value.Seal(encValue, encValue[:nonceSize], value, encKey)
+	return s.store.Put(encKey, encValue)
+}
+
+func (s *encrypted) Delete(key []byte) error {
+	return s.store.Delete(s.key.Seal(nil, nil, key, nil))
+}
+
+func (s *encrypted) Iterate(fn func(key, value []byte) error) error {
+	return s.store.Iterate(func(encKey, encValue []byte) error {
+		key, err := s.key.Open(nil, nil, encKey, nil)
+		if err != nil {
+			return err
+		}
+		value, err := s.openValue(encKey, encValue)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+func (s *encrypted) openValue(encKey, encValue []byte) ([]byte, error) {
+	if len(encValue) < nonceSize+s.value.Overhead() {
+		return nil, errValue
+	}
+	return s.value.Open(nil, encValue[:nonceSize], encValue[nonceSize:], encKey)
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package kv implements simple key-value stores and a wrapper
+// that encrypts the keys and values of any Store.
+//
+// Encrypted encrypts lookup keys deterministically with AES-SIV-CMAC
+// (siv.NewCMAC with an empty nonce) such that Get still works with
+// exact-match lookups. Values are encrypted with AES-GCM-SIV
+// (siv.NewGCM) under a random nonce and bound to their encrypted
+// key. Hence, values cannot be swapped between keys.
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/secure-io/siv-go/internal/atomicfile"
+)
+
+// ErrNotFound is returned by Get if the store
+// contains no value for a key.
+var ErrNotFound = errors.New("kv: key not found")
+
+var errFormat = errors.New("kv: invalid store file")
+
+// Store is a key-value store.
+//
+// Implementations must be safe for concurrent use
+// by multiple goroutines.
+type Store interface {
+	// Get returns the value associated with key or
+	// ErrNotFound if there is none.
+	Get(key []byte) ([]byte, error)
+
+	// Put associates the value with key. It replaces
+	// any existing value.
+	Put(key, value []byte) error
+
+	// Delete removes the value associated with key. It
+	// does not return an error if there is no value.
+	Delete(key []byte) error
+
+	// Iterate calls fn for every key-value pair. It stops
+	// and returns the error if fn returns a non-nil error.
+	// fn must not retain or modify key or value.
+	Iterate(fn func(key, value []byte) error) error
+}
+
+// Memory is an in-memory Store. It iterates over its
+// entries in lexicographical key order.
+type Memory struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns a new, empty in-memory store.
+func NewMemory() *Memory { return &Memory{entries: map[string][]byte{}} }
+
+// Get returns the value associated with key.
+func (m *Memory) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.entries[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Put associates the value with key.
+func (m *Memory) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes the value associated with key.
+func (m *Memory) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, string(key))
+	return nil
+}
+
+// Iterate calls fn for every key-value pair in key order.
+// fn may modify the store.
+func (m *Memory) Iterate(fn func(key, value []byte) error) error {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = m.entries[key] // values are never modified in place
+	}
+	m.mu.RUnlock()
+
+	for i, key := range keys {
+		if err := fn([]byte(key), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// File is a Store backed by a file. It keeps all entries in
+// memory and rewrites the file atomically on every Put and
+// Delete. Therefore, it is only suitable for small stores.
+type File struct {
+	path string
+
+	mu  sync.Mutex // serializes writes to the file
+	mem *Memory
+}
+
+var _ Store = (*File)(nil)
+
+var fileMagic = [4]byte{'S', 'I', 'K', 'V'}
+
+const fileVersion = 1
+
+// OpenFile opens the store file at path. It creates
+// a new, empty store if the file does not exist.
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path, mem: NewMemory()}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 5 || !bytes.Equal(data[:4], fileMagic[:]) || data[4] != fileVersion {
+		return nil, errFormat
+	}
+	for data = data[5:]; len(data) > 0; {
+		var key, value []byte
+		if key, data, err = readBytes(data); err != nil {
+			return nil, err
+		}
+		if value, data, err = readBytes(data); err != nil {
+			return nil, err
+		}
+		f.mem.entries[string(key)] = value
+	}
+	return f, nil
+}
+
+// Get returns the value associated with key.
+func (f *File) Get(key []byte) ([]byte, error) { return f.mem.Get(key) }
+
+// Put associates the value with key and writes
+// the store to its file.
+func (f *File) Put(key, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old, exists := f.mem.entries[string(key)]
+	f.mem.Put(key, value)
+	if err := f.store(); err != nil {
+		if exists {
+			f.mem.Put(key, old)
+		} else {
+			f.mem.Delete(key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the value associated with key and
+// writes the store to its file.
+func (f *File) Delete(key []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old, exists := f.mem.entries[string(key)]
+	if !exists {
+		return nil
+	}
+	f.mem.Delete(key)
+	if err := f.store(); err != nil {
+		f.mem.Put(key, old)
+		return err
+	}
+	return nil
+}
+
+// Iterate calls fn for every key-value pair in key order.
+// fn may modify the store.
+func (f *File) Iterate(fn func(key, value []byte) error) error { return f.mem.Iterate(fn) }
+
+// store writes all entries to a temporary file, syncs it
+// and replaces the store file with it.
+func (f *File) store() error {
+	var buf bytes.Buffer
+	buf.Write(fileMagic[:])
+	buf.WriteByte(fileVersion)
+	f.mem.Iterate(func(key, value []byte) error {
+		writeBytes(&buf, key)
+		writeBytes(&buf, value)
+		return nil
+	})
+
+	return atomicfile.WriteFile(f.path, buf.Bytes(), 0600)
+}
+
+func writeBytes(w *bytes.Buffer, b []byte) {
+	var n [binary.MaxVarintLen64]byte
+	w.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+	w.Write(b)
+}
+
+// readBytes reads a length-prefixed byte string from data
+// and returns it and the remaining data. The length is checked
+// against the remaining data such that a corrupted length
+// cannot cause a large allocation.
+func readBytes(data []byte) (b, rest []byte, err error) {
+	n, k := binary.Uvarint(data)
+	if k <= 0 || n > uint64(len(data)-k) {
+		return nil, nil, errFormat
+	}
+	data = data[k:]
+	return append([]byte(nil), data[:n]...), data[n:], nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testStore(t *testing.T, name string, store Store) {
+	entries := map[string]string{"alice": "secret-1", "bob": "secret-2", "": "empty key", "carol": ""}
+	for key, value := range entries {
+		if err := store.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("%s: Put failed: %v", name, err)
+		}
+	}
+	if err := store.Put([]byte("bob"), []byte("secret-3")); err != nil {
+		t.Fatalf("%s: Put failed: %v", name, err)
+	}
+	entries["bob"] = "secret-3"
+	if err := store.Delete([]byte("carol")); err != nil {
+		t.Fatalf("%s: Delete failed: %v", name, err)
+	}
+	delete(entries, "carol")
+	if err := store.Delete([]byte("dave")); err != nil {
+		t.Fatalf("%s: Delete of missing key failed: %v", name, err)
+	}
+
+	for key, value := range entries {
+		v, err := store.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("%s: Get(%q) failed: %v", name, key, err)
+		}
+		if string(v) != value {
+			t.Fatalf("%s: Get(%q): got %q - want %q", name, key, v, value)
+		}
+	}
+	if _, err := store.Get([]byte("carol")); err != ErrNotFound {
+		t.Fatalf("%s: Get of deleted key: got %v - want %v", name, err, ErrNotFound)
+	}
+
+	found := map[string]string{}
+	err := store.Iterate(func(key, value []byte) error {
+		found[string(key)] = string(value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: Iterate failed: %v", name, err)
+	}
+	if len(found) != len(entries) {
+		t.Fatalf("%s: Iterate: got %d entries - want %d", name, len(found), len(entries))
+	}
+	for key, value := range entries {
+		if found[key] != value {
+			t.Fatalf("%s: Iterate: got %q for %q - want %q", name, found[key], key, value)
+		}
+	}
+
+	errStop := errors.New("stop")
+	if err = store.Iterate(func(key, value []byte) error { return errStop }); err != errStop {
+		t.Fatalf("%s: Iterate: got %v - want %v", name, err, errStop)
+	}
+}
+
+var testKeys = Keys{Key: make([]byte, 64), Value: make([]byte, 32)}
+
+func TestStore(t *testing.T) {
+	testStore(t, "Memory", NewMemory())
+
+	path := filepath.Join(t.TempDir(), "store")
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	testStore(t, "File", file)
+
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if v, err := reopened.Get([]byte("bob")); err != nil || string(v) != "secret-3" {
+		t.Fatalf("File: Get after reopen: got %q, %v", v, err)
+	}
+
+	encrypted, err := Encrypted(NewMemory(), testKeys)
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %v", err)
+	}
+	testStore(t, "Encrypted", encrypted)
+}
+
+func TestOpenFileCorrupted(t *testing.T) {
+	header := append(fileMagic[:], fileVersion)
+	tests := [][]byte{
+		header[:4],
+		append(append([]byte{}, header...), 0xff, 0xff, 0xff, 0xff, 0x07, 'k'), // length of 2^31-1 bytes
+		append(append([]byte{}, header...), 0x02, 'k'),                         // truncated key
+		append(append([]byte{}, header...), 0x01, 'k'),                         // missing value
+		append(append([]byte{}, header...), 0x01, 'k', 0x80),                   // truncated length
+	}
+	for i, data := range tests {
+		path := filepath.Join(t.TempDir(), "store")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Test %d: Failed to write file: %v", i, err)
+		}
+		if _, err := OpenFile(path); err != errFormat {
+			t.Fatalf("Test %d: got error %v - want %v", i, err, errFormat)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	mem := NewMemory()
+	store, _ := Encrypted(mem, testKeys)
+	store.Put([]byte("alice"), []byte("secret-1"))
+	store.Put([]byte("bob"), []byte("secret-2"))
+
+	var encKeys, encValues [][]byte
+	mem.Iterate(func(key, value []byte) error {
+		if bytes.Contains(key, []byte("alice")) || bytes.Contains(key, []byte("bob")) {
+			t.Fatalf("plaintext key found: %q", key)
+		}
+		if bytes.Contains(value, []byte("secret")) {
+			t.Fatalf("plaintext value found: %q", value)
+		}
+		encKeys = append(encKeys, key)
+		encValues = append(encValues, value)
+		return nil
+	})
+
+	// Swap the values of alice and bob.
+	mem.Put(encKeys[0], encValues[1])
+	mem.Put(encKeys[1], encValues[0])
+	if _, err := store.Get([]byte("alice")); err == nil {
+		t.Fatal("Get succeeded for swapped value")
+	}
+	if err := store.Iterate(func(key, value []byte) error { return nil }); err == nil {
+		t.Fatal("Iterate succeeded for swapped value")
+	}
+
+	store.Put([]byte("alice"), []byte("secret-1"))
+	other, _ := Encrypted(mem, Keys{Key: testKeys.Key, Value: bytes.Repeat([]byte{1}, 32)})
+	if _, err := other.Get([]byte("alice")); err == nil {
+		t.Fatal("Get succeeded with wrong value key")
+	}
+
+	if _, err := Encrypted(mem, Keys{Key: make([]byte, 16), Value: make([]byte, 32)}); err == nil {
+		t.Fatal("Encrypted accepted an invalid key size")
+	}
+}
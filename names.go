@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+const (
+	// MaxNameLength is the maximum length of an encrypted name.
+	// Longer encrypted names are replaced by a hashed long name.
+	MaxNameLength = 255
+
+	// LongNamePrefix is the prefix of a hashed long name.
+	LongNamePrefix = "siv.longname."
+
+	// LongNameSuffix is appended to a hashed long name to form
+	// the name of the sidecar file containing the full encrypted
+	// name.
+	LongNameSuffix = ".name"
+)
+
+// nameEncoding is a lower-case, unpadded base32 encoding. It
+// only uses characters that are valid in file names on all
+// common file systems and does not depend on case.
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+var (
+	errInvalidName     = errors.New("siv: invalid file name")
+	errInvalidEncName  = errors.New("siv: invalid encrypted file name")
+	errSidecarMismatch = errors.New("siv: sidecar does not match long name")
+)
+
+// NameCipher encrypts file and directory names deterministically
+// using AES-SIV-CMAC with an empty nonce. The ID of the parent
+// directory is bound as additional data such that an encrypted
+// name cannot be moved to another directory. Encrypting the same
+// name within the same directory always produces the same
+// encrypted name. Hence, files can be looked up by name without
+// decrypting the entire directory.
+//
+// Encrypted names are encoded using lower-case, unpadded base32
+// and are therefore safe for case-insensitive file systems. If
+// the encoded name exceeds MaxNameLength bytes, it is replaced by
+// LongNamePrefix followed by the encoded SHA-256 hash of the full
+// encrypted name. The full encrypted name must then be stored in
+// a sidecar file named like the long name plus LongNameSuffix.
+type NameCipher struct {
+	aead cipher.AEAD
+}
+
+// NewNameCipher returns a NameCipher using AES-SIV-CMAC. The key
+// must be either 32, 48 or 64 bytes long.
+func NewNameCipher(key []byte) (*NameCipher, error) {
+	aead, err := NewCMAC(key)
+	if err != nil {
+		return nil, err
+	}
+	return &NameCipher{aead: aead}, nil
+}
+
+// EncryptName encrypts the name of a file or directory within
+// the directory identified by parentDirID.
+//
+// If the encrypted name is longer than MaxNameLength, EncryptName
+// returns a long name and a non-empty sidecar. The caller must
+// store the sidecar in the file encName + LongNameSuffix.
+func (c *NameCipher) EncryptName(parentDirID []byte, name string) (encName, sidecar string, err error) {
+	if !validName(name) {
+		return "", "", errInvalidName
+	}
+	encName = nameEncoding.EncodeToString(c.aead.Seal(nil, nil, []byte(name), parentDirID))
+	if len(encName) <= MaxNameLength {
+		return encName, "", nil
+	}
+	return longName(encName), encName, nil
+}
+
+// DecryptName decrypts the encrypted name of a file or directory
+// within the directory identified by parentDirID. If encName is a
+// long name, sidecar must be the content of its sidecar file.
+// Otherwise, sidecar is ignored.
+//
+// DecryptName ignores the case of encName and sidecar since a
+// case-insensitive file system may return names with a different
+// case.
+func (c *NameCipher) DecryptName(parentDirID []byte, encName, sidecar string) (string, error) {
+	encName, sidecar = strings.ToLower(encName), strings.ToLower(sidecar)
+	if IsLongName(encName) {
+		if subtle.ConstantTimeCompare([]byte(longName(sidecar)), []byte(encName)) != 1 {
+			return "", errSidecarMismatch
+		}
+		encName = sidecar
+	} else if len(encName) > MaxNameLength {
+		return "", errInvalidEncName
+	}
+
+	ciphertext, err := nameEncoding.DecodeString(encName)
+	if err != nil {
+		return "", errInvalidEncName
+	}
+	plaintext, err := c.aead.Open(nil, nil, ciphertext, parentDirID)
+	if err != nil {
+		return "", err
+	}
+	if name := string(plaintext); !validName(name) {
+		return "", errInvalidName
+	}
+	return string(plaintext), nil
+}
+
+// IsLongName reports whether name is a hashed long name. It
+// returns false for the name of a sidecar file. Like DecryptName,
+// it ignores the case of name.
+func IsLongName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, LongNamePrefix) && !strings.HasSuffix(name, LongNameSuffix)
+}
+
+func longName(encName string) string {
+	sum := sha256.Sum256([]byte(encName))
+	return LongNamePrefix + nameEncoding.EncodeToString(sum[:])
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
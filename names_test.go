@@ -0,0 +1,86 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameCipherRFC5297(t *testing.T) {
+	// RFC 5297 Appendix A.1 - Deterministic Authenticated Encryption Example
+	key := mustDecode("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	parentDirID := mustDecode("101112131415161718191a1b1c1d1e1f2021222324252627")
+	name := string(mustDecode("112233445566778899aabbccddee"))
+	ciphertext := mustDecode("85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c")
+
+	c, err := NewNameCipher(key)
+	if err != nil {
+		t.Fatalf("Failed to create name cipher: %v", err)
+	}
+	encName, sidecar, err := c.EncryptName(parentDirID, name)
+	if err != nil {
+		t.Fatalf("EncryptName failed: %v", err)
+	}
+	if want := nameEncoding.EncodeToString(ciphertext); encName != want || sidecar != "" {
+		t.Fatalf("got %q - want %q", encName, want)
+	}
+	if plaintext, err := c.DecryptName(parentDirID, strings.ToUpper(encName), ""); err != nil || plaintext != name {
+		t.Fatalf("DecryptName of upper-case name failed: %v", err)
+	}
+}
+
+func TestNameCipher(t *testing.T) {
+	c, _ := NewNameCipher(make([]byte, 64))
+	parentDirID := []byte("parent")
+
+	for i, name := range []string{"a", "README.md", "Ünïcödé name", strings.Repeat("x", 143), strings.Repeat("y", 144), strings.Repeat("z", 255)} {
+		encName, sidecar, err := c.EncryptName(parentDirID, name)
+		if err != nil {
+			t.Fatalf("Test %d: EncryptName failed: %v", i, err)
+		}
+		if len(encName) > MaxNameLength || strings.ToLower(encName) != encName {
+			t.Fatalf("Test %d: invalid encrypted name: %q", i, encName)
+		}
+		if IsLongName(encName) != (sidecar != "") {
+			t.Fatalf("Test %d: long name mismatch: %q", i, encName)
+		}
+		if IsLongName(encName + LongNameSuffix) {
+			t.Fatalf("Test %d: sidecar is reported as long name", i)
+		}
+		if again, _, _ := c.EncryptName(parentDirID, name); again != encName {
+			t.Fatalf("Test %d: encryption is not deterministic", i)
+		}
+
+		plaintext, err := c.DecryptName(parentDirID, encName, sidecar)
+		if err != nil {
+			t.Fatalf("Test %d: DecryptName failed: %v", i, err)
+		}
+		if plaintext != name {
+			t.Fatalf("Test %d: got %q - want %q", i, plaintext, name)
+		}
+		if IsLongName(strings.ToUpper(encName)) != (sidecar != "") {
+			t.Fatalf("Test %d: long name check depends on case", i)
+		}
+		if plaintext, err = c.DecryptName(parentDirID, strings.ToUpper(encName), strings.ToUpper(sidecar)); err != nil || plaintext != name {
+			t.Fatalf("Test %d: DecryptName failed for upper-case name: %v", i, err)
+		}
+		if _, err = c.DecryptName([]byte("other"), encName, sidecar); err == nil {
+			t.Fatalf("Test %d: DecryptName succeeded for other directory", i)
+		}
+		if sidecar != "" {
+			other, _, _ := c.EncryptName(parentDirID, name+"-")
+			if _, err = c.DecryptName(parentDirID, encName, other); err == nil {
+				t.Fatalf("Test %d: DecryptName succeeded for wrong sidecar", i)
+			}
+		}
+	}
+
+	for i, name := range []string{"", ".", "..", "a/b", "a\x00b"} {
+		if _, _, err := c.EncryptName(parentDirID, name); err == nil {
+			t.Fatalf("Test %d: EncryptName accepted invalid name %q", i, name)
+		}
+	}
+}
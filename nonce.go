@@ -0,0 +1,175 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/secure-io/siv-go/internal/atomicfile"
+)
+
+// ErrNonceExhausted is returned by a NonceSequence when
+// all nonces of the sequence have been issued.
+var ErrNonceExhausted = errors.New("siv: nonce sequence exhausted")
+
+var errNonceState = errors.New("siv: invalid nonce sequence state file")
+
+// nonceReservation is the number of nonces a NonceSequence
+// reserves in its state file at once. At most nonceReservation
+// nonces of a sequence are skipped after a crash.
+const nonceReservation = 1 << 16
+
+var nonceStateMagic = [4]byte{'S', 'I', 'V', 'N'}
+
+const nonceStateVersion = 1
+
+// NonceSequence produces a deterministic, gap-free sequence of
+// unique nonces. Each nonce consists of a fixed prefix followed
+// by a big-endian counter filling the remaining bytes.
+//
+// A NonceSequence persists the counter in a state file. Before
+// issuing any nonce it reserves a range of counter values by
+// writing the end of the range to the state file and syncing it
+// to stable storage. When the sequence is re-opened it continues
+// at the end of the last reserved range. Therefore, a crash never
+// causes a nonce to be issued twice - but may skip the unused part
+// of the last reserved range.
+//
+// The state file must not be used by more than one NonceSequence
+// at the same time. A NonceSequence is safe for concurrent use by
+// multiple goroutines.
+type NonceSequence struct {
+	mu sync.Mutex
+
+	path   string
+	prefix []byte
+	size   int
+
+	counter uint64 // the next counter value
+	limit   uint64 // the end of the reserved range (exclusive)
+	max     uint64 // the largest counter value
+}
+
+// NewNonceSequence returns a NonceSequence producing nonceSize
+// bytes long nonces starting with the given prefix. The nonceSize
+// must be either 12 (AES-GCM-SIV) or 16 (AES-SIV-CMAC) and the
+// prefix must be shorter than the nonceSize.
+//
+// The counter state is kept in the file at path. If the file does
+// not exist the sequence starts at zero. If it exists it must have
+// been created for the same prefix and nonce size.
+func NewNonceSequence(path string, prefix []byte, nonceSize int) (*NonceSequence, error) {
+	if nonceSize != 12 && nonceSize != 16 {
+		return nil, errors.New("siv: invalid nonce size for nonce sequence")
+	}
+	if len(prefix) >= nonceSize {
+		return nil, errors.New("siv: nonce prefix too large for nonce sequence")
+	}
+
+	s := &NonceSequence{
+		path:   path,
+		prefix: append([]byte(nil), prefix...),
+		size:   nonceSize,
+		max:    math.MaxUint64 - 1,
+	}
+	if n := nonceSize - len(prefix); n < 8 {
+		s.max = 1<<(8*uint(n)) - 1
+	}
+
+	state, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.counter, err = s.parseState(state); err != nil {
+		return nil, err
+	}
+	s.limit = s.counter
+	return s, nil
+}
+
+// NonceSize returns the size of the nonces produced by
+// the sequence.
+func (s *NonceSequence) NonceSize() int { return s.size }
+
+// Next returns the next nonce of the sequence. It returns
+// ErrNonceExhausted if the counter limit has been reached.
+func (s *NonceSequence) Next() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counter > s.max {
+		return nil, ErrNonceExhausted
+	}
+	if s.counter == s.limit {
+		limit := s.max + 1
+		if s.max-s.counter >= nonceReservation {
+			limit = s.counter + nonceReservation
+		}
+		if err := s.storeState(limit); err != nil {
+			return nil, err
+		}
+		s.limit = limit
+	}
+
+	nonce := make([]byte, s.size)
+	copy(nonce, s.prefix)
+	putCounter(nonce[len(s.prefix):], s.counter)
+	s.counter++
+	return nonce, nil
+}
+
+// storeState writes limit to a temporary file, syncs it and
+// replaces the state file with it.
+func (s *NonceSequence) storeState(limit uint64) error {
+	state := make([]byte, 0, 4+3+len(s.prefix)+8)
+	state = append(state, nonceStateMagic[:]...)
+	state = append(state, nonceStateVersion, byte(s.size), byte(len(s.prefix)))
+	state = append(state, s.prefix...)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], limit)
+	state = append(state, b[:]...)
+
+	return atomicfile.WriteFile(s.path, state, 0600)
+}
+
+func (s *NonceSequence) parseState(state []byte) (uint64, error) {
+	if len(state) < 4+3 || !bytes.Equal(state[:4], nonceStateMagic[:]) || state[4] != nonceStateVersion {
+		return 0, errNonceState
+	}
+	if int(state[5]) != s.size || int(state[6]) != len(s.prefix) {
+		return 0, errors.New("siv: nonce sequence state file does not match nonce size or prefix")
+	}
+	state = state[7:]
+	if len(state) != len(s.prefix)+8 {
+		return 0, errNonceState
+	}
+	if !bytes.Equal(state[:len(s.prefix)], s.prefix) {
+		return 0, errors.New("siv: nonce sequence state file does not match nonce size or prefix")
+	}
+	limit := binary.BigEndian.Uint64(state[len(s.prefix):])
+	if limit > s.max+1 {
+		return 0, errNonceState
+	}
+	return limit, nil
+}
+
+// putCounter writes c as big-endian integer into b. If b is
+// shorter than 8 bytes only the least significant bytes of c
+// are written.
+func putCounter(b []byte, c uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(c)
+		c >>= 8
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+)
+
+func TestNonceSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonce")
+	prefix := mustDecode("a0a1a2a3")
+
+	s, err := NewNonceSequence(path, prefix, 12)
+	if err != nil {
+		t.Fatalf("Failed to create nonce sequence: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		nonce, err := s.Next()
+		if err != nil {
+			t.Fatalf("Test %d: Next failed: %v", i, err)
+		}
+		expected := mustDecode("a0a1a2a30000000000000000")
+		expected[11] = byte(i)
+		if !bytes.Equal(nonce, expected) {
+			t.Fatalf("Test %d: nonce mismatch: got %s - want %s", i, hex.EncodeToString(nonce), hex.EncodeToString(expected))
+		}
+	}
+
+	// A re-opened sequence must continue after the reserved range.
+	s, err = NewNonceSequence(path, prefix, 12)
+	if err != nil {
+		t.Fatalf("Failed to re-open nonce sequence: %v", err)
+	}
+	nonce, err := s.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if expected := mustDecode("a0a1a2a30000000000010000"); !bytes.Equal(nonce, expected) {
+		t.Fatalf("nonce mismatch: got %s - want %s", hex.EncodeToString(nonce), hex.EncodeToString(expected))
+	}
+
+	if _, err = NewNonceSequence(path, mustDecode("b0b1b2b3"), 12); err == nil {
+		t.Fatal("Re-opened nonce sequence with different prefix")
+	}
+	if _, err = NewNonceSequence(path, prefix, 16); err == nil {
+		t.Fatal("Re-opened nonce sequence with different nonce size")
+	}
+}
+
+func TestNonceSequenceExhausted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonce")
+	prefix := make([]byte, 15)
+
+	s, err := NewNonceSequence(path, prefix, 16)
+	if err != nil {
+		t.Fatalf("Failed to create nonce sequence: %v", err)
+	}
+	for i := 0; i < 256; i++ {
+		nonce, err := s.Next()
+		if err != nil {
+			t.Fatalf("Test %d: Next failed: %v", i, err)
+		}
+		if nonce[15] != byte(i) {
+			t.Fatalf("Test %d: counter mismatch: got %d", i, nonce[15])
+		}
+	}
+	if _, err = s.Next(); err != ErrNonceExhausted {
+		t.Fatalf("Expected ErrNonceExhausted - got: %v", err)
+	}
+
+	s, err = NewNonceSequence(path, prefix, 16)
+	if err != nil {
+		t.Fatalf("Failed to re-open nonce sequence: %v", err)
+	}
+	if _, err = s.Next(); err != ErrNonceExhausted {
+		t.Fatalf("Expected ErrNonceExhausted after re-open - got: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// selfTestVectors are known-answer tests from RFC 5297
+// (Appendix A) and RFC 8452 (Appendix C).
+//
+// Neither RFC contains a vector for a 48 byte AES-SIV-CMAC key or
+// a plaintext of 128 bytes or more, which the assembler backends
+// process in blocks of eight. The last three vectors cover these
+// cases. They have been computed with OpenSSL's AES-192-SIV and an
+// RFC 8452 reference implementation checked against Appendix C.
+var selfTestVectors = []struct {
+	gcm                                               bool
+	key, plaintext, additionalData, nonce, ciphertext string
+}{
+	{
+		gcm:            false, // RFC 5297, A.1
+		key:            "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		plaintext:      "112233445566778899aabbccddee",
+		additionalData: "101112131415161718191a1b1c1d1e1f2021222324252627",
+		ciphertext:     "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+	},
+	{
+		gcm:            false, // RFC 5297, A.2
+		key:            "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+		plaintext:      "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+		additionalData: "00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+		nonce:          "09f911029d74e35bd84156c5635688c0",
+		ciphertext:     "85825e22e90cf2ddda2c548dc7c1b6310dcdaca0cebf9dc6cb90583f5bf1506e02cd48832b00e4e598b2b22a53e6199d4df0c1666a35a0433b250dc134d776",
+	},
+	{
+		gcm:        true, // RFC 8452, C.1
+		key:        "01000000000000000000000000000000",
+		plaintext:  "01000000000000000000000000000000020000000000000000000000000000000300000000000000000000000000000004000000000000000000000000000000",
+		nonce:      "030000000000000000000000",
+		ciphertext: "2433668f1058190f6d43e360f4f35cd8e475127cfca7028ea8ab5c20f7ab2af02516a2bdcbc08d521be37ff28c152bba36697f25b4cd169c6590d1dd39566d3f8a263dd317aa88d56bdf3936dba75bb8",
+	},
+	{
+		gcm:            true, // RFC 8452, C.1
+		key:            "bde3b2f204d1e9f8b06bc47f9745b3d1",
+		plaintext:      "6b3db4da3d57aa94842b9803a96e07fb6de7",
+		additionalData: "1860f762ebfbd08284e421702de0de18baa9c9596291b08466f37de21c7f",
+		nonce:          "ae06556fb6aa7890bebc18fe",
+		ciphertext:     "6298b296e24e8cc35dce0bed484b7f30d5803e377094f04709f64d7b985310a4db84",
+	},
+	{
+		gcm:            true, // RFC 8452, C.2
+		key:            "3c535de192eaed3822a2fbbe2ca9dfc88255e14a661b8aa82cc54236093bbc23",
+		plaintext:      "ced532ce4159b035277d4dfbb7db62968b13cd4eec",
+		additionalData: "734320ccc9d9bbbb19cb81b2af4ecbc3e72834321f7aa0f70b7282b4f33df23f167541",
+		nonce:          "688089e55540db1872504e1c",
+		ciphertext:     "626660c26ea6612fb17ad91e8e767639edd6c9faee9d6c7029675b89eaf4ba1ded1a286594",
+	},
+	{
+		gcm:            false, // 48 byte key, 143 byte plaintext
+		key:            "404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f",
+		plaintext:      "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e",
+		additionalData: "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebfc0c1c2c3c4c5c6c7",
+		nonce:          "d0d1d2d3d4d5d6d7d8d9dadbdcdddedf",
+		ciphertext:     "0983ac3777ac7d2c2f6326f1776a1e0a8f53a3712e1b7b26af06aa141271b3c8c93aeb648808ba4ada81587ed3277c8f476a61a0392ecf91967379a7086afbc52e70167fb3cc91f42236aa928651b897611835b27d52fd8aa4b03b25c6c437857debcbadc6a064717b047a614e0f5f5b4421394e2c9a1788793cd5314414c4ba0c575943db061b195a07c37e246a0b45b3be927f29effb073250e5a960f239",
+	},
+	{
+		gcm:            true, // 16 byte key, 143 byte plaintext
+		key:            "101112131415161718191a1b1c1d1e1f",
+		plaintext:      "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e",
+		additionalData: "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebfc0c1c2c3c4c5c6c7",
+		nonce:          "303132333435363738393a3b",
+		ciphertext:     "2d807620dc775e7c3a4016383cb95567c351c6eee19c89e08ac38cf2d2eaba2c5899dae6755f8e2038e5d42e4dd742e7a9a4f10b31d9ccc00c9c296f9bda557492a28796aa23f827ed66bba0f6b0726e7b6bc77ce169ff302045d92b0c13c54b401e0bb025be7098f6d43259b1a038877405dd84e4b67ea2806319ec58ade07eb57f5693ae1701cd3d9ae6fded942b5f2deee69d92b7d0f63a31d17f0c4522",
+	},
+	{
+		gcm:        true, // 32 byte key, 256 byte plaintext
+		key:        "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f",
+		plaintext:  "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9fa0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebfc0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedfe0e1e2e3e4e5e6e7e8e9eaebecedeeeff0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		nonce:      "303132333435363738393a3b",
+		ciphertext: "b7e57631b99695728b10d3a6b5b8435138944812c3a4184d86d449edbe7266a1a8894259422e402159949ef0f216769ab45645c21d83c42bd00f26b1b7b244086407dc4f83b6289a24581619a2cdadc0043c0ddf8223608fed574275d8ef4a9af2fd7b0a54ebecbfdfb05e6144e8b8b91570be7d55a181d43677188c2645e0525a30359398fb9f1f279809e3446b82c05a3428b759a4cb9885a6aaa25d3f9c63f6651a7175faf8133f455e90ae307e8addfd409636b2d29258f49af9599c66f0fd315f7bd681514ab56f7687bcc4ec5d507fced2ab2f1faab0c4f29bb6dfc95244c0990cfdf0c64757e24103c83d7dff128ad2fc1225108fbd78b449c3737e6ed37c3de8ff4228dcd4bf3e2d306e7c10",
+	},
+}
+
+var (
+	selfTestOnce sync.Once
+	selfTestLock sync.RWMutex
+	selfTestErr  error
+)
+
+// SelfTest runs known-answer tests - mostly from RFC 5297 and
+// RFC 8452 - against every backend supported by the CPU.
+//
+// The first call of a constructor - e.g. NewCMAC or NewGCM -
+// runs SelfTest implicitly. Once SelfTest has failed, all
+// constructors fail with the same error.
+func SelfTest() error {
+	if err := runSelfTest(); err != nil {
+		selfTestLock.Lock()
+		if selfTestErr == nil {
+			selfTestErr = err
+		}
+		selfTestLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// checkSelfTest runs SelfTest once and returns an
+// error if any SelfTest has failed.
+func checkSelfTest() error {
+	selfTestOnce.Do(func() { SelfTest() })
+
+	selfTestLock.RLock()
+	defer selfTestLock.RUnlock()
+	return selfTestErr
+}
+
+func runSelfTest() error {
+	for _, backend := range Backends() {
+		for i, v := range selfTestVectors {
+			key, _ := hex.DecodeString(v.key)
+			plaintext, _ := hex.DecodeString(v.plaintext)
+			additionalData, _ := hex.DecodeString(v.additionalData)
+			nonce, _ := hex.DecodeString(v.nonce)
+			ciphertext, _ := hex.DecodeString(v.ciphertext)
+
+			var c cipher.AEAD
+			if v.gcm {
+				gcm, err := newGCM(key, backend, false)
+				if err != nil {
+					return err
+				}
+				c = &aesGcmSiv{gcm}
+			} else {
+				cmac, err := newCMAC(key, backend, false)
+				if err != nil {
+					return err
+				}
+				c = &aesSivCMac{cmac}
+			}
+			impl := Implementation(c)
+			err := knownAnswerTest(c, nonce, plaintext, additionalData, ciphertext)
+			c.(Destroyer).Destroy()
+			if err != nil {
+				return fmt.Errorf("siv: self-test %d failed for %s backend: %v", i, impl, err)
+			}
+		}
+	}
+	return nil
+}
+
+func knownAnswerTest(c cipher.AEAD, nonce, plaintext, additionalData, ciphertext []byte) error {
+	if !bytes.Equal(c.Seal(nil, nonce, plaintext, additionalData), ciphertext) {
+		return errors.New("ciphertext mismatch")
+	}
+	p, err := c.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil || !bytes.Equal(p, plaintext) {
+		return errors.New("plaintext mismatch")
+	}
+	modified := append([]byte(nil), ciphertext...)
+	modified[len(modified)-1] ^= 1
+	if _, err = c.Open(nil, nonce, modified, additionalData); err == nil {
+		return errors.New("modified ciphertext accepted")
+	}
+	return nil
+}
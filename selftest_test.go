@@ -0,0 +1,56 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/aes"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if err := checkSelfTest(); err != nil {
+		t.Fatalf("checkSelfTest failed: %v", err)
+	}
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	checkSelfTest() // Run the implicit self-test before modifying the vectors
+	v := selfTestVectors[len(selfTestVectors)-1]
+	defer func() {
+		selfTestVectors[len(selfTestVectors)-1] = v
+		selfTestErr = nil
+	}()
+	selfTestVectors[len(selfTestVectors)-1].ciphertext = "00" + v.ciphertext[2:]
+
+	if err := SelfTest(); err == nil {
+		t.Fatal("SelfTest succeeded for a wrong known answer")
+	}
+	selfTestVectors[len(selfTestVectors)-1] = v
+	if err := SelfTest(); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	// Constructors must fail closed - even if a subsequent
+	// SelfTest succeeds.
+	if _, err := NewCMAC(make([]byte, 32)); err == nil {
+		t.Fatal("NewCMAC succeeded after a failed self-test")
+	}
+	if _, err := NewGCM(make([]byte, 16)); err == nil {
+		t.Fatal("NewGCM succeeded after a failed self-test")
+	}
+	if _, err := NewExtendedGCM(make([]byte, 16), 24); err == nil {
+		t.Fatal("NewExtendedGCM succeeded after a failed self-test")
+	}
+	if _, err := NewGCMSIVFromBlock(aes.NewCipher, make([]byte, 16)); err == nil {
+		t.Fatal("NewGCMSIVFromBlock succeeded after a failed self-test")
+	}
+	block, _ := aes.NewCipher(make([]byte, 16))
+	if _, err := NewCMACFromBlocks(block, block); err == nil {
+		t.Fatal("NewCMACFromBlocks succeeded after a failed self-test")
+	}
+}
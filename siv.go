@@ -5,7 +5,7 @@
 // Package siv implements the Synthetic Initialization Vector (SIV)
 // authenticated encryption scheme specified in RFC 5297. It also
 // implements AES-GCM-SIV as misuse-resistant version of AES-GCM as
-// proposed by the RFC-draft [1].
+// specified in RFC 8452 [1].
 //
 //
 // AES-GCM-SIV
@@ -43,13 +43,14 @@
 // AEAD which can be turned into a probabilistic AEAD using a nonce value
 // is called misuse-resistant AEAD.
 //
-// [1] https://tools.ietf.org/html/draft-irtf-cfrg-gcmsiv-08
+// [1] https://tools.ietf.org/html/rfc8452
 // [2] https://tools.ietf.org/html/rfc5297
 // [3] https://en.wikipedia.org/wiki/Deterministic_encryption
 package siv
 
 import (
 	"errors"
+	"unsafe"
 )
 
 var errOpen = errors.New("siv: message authentication failed")
@@ -58,6 +59,10 @@ type aead interface {
 	seal(ciphertext, nonce, plaintext, additionalData []byte)
 
 	open(plaintext, nonce, ciphertext, additionalData []byte) error
+
+	destroy()
+
+	backend() Backend
 }
 
 // sliceForAppend takes a slice and a requested number of bytes. It returns a
@@ -74,3 +79,11 @@ func sliceForAppend(in []byte, n int) (head, tail []byte) {
 	tail = head[len(in):]
 	return
 }
+
+// anyOverlap reports whether x and y share memory at any
+// (not necessarily corresponding) index.
+func anyOverlap(x, y []byte) bool {
+	return len(x) > 0 && len(y) > 0 &&
+		uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
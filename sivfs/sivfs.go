@@ -0,0 +1,420 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package sivfs implements a read-only io/fs.FS that decrypts
+// a directory tree of encrypted files.
+//
+// Each file or directory name is encrypted with a siv.NameCipher
+// using the plaintext path of the parent directory as directory ID.
+// Hence, a name can be looked up without decrypting the directory
+// listing and an encrypted entry cannot be moved to another
+// directory. Encrypted names are lower-case and therefore safe for
+// case-insensitive file systems. Encrypted names longer than
+// siv.MaxNameLength are stored as hashed long names with a sidecar
+// file - see siv.NameCipher.
+//
+// The content of a regular file is encrypted with AES-256-GCM-SIV
+// (siv.NewGCM) using the plaintext path of the file as additional
+// data:
+//
+//	nonce (12 bytes) || ciphertext || tag (16 bytes)
+//
+// A file is decrypted and authenticated as a whole on its first
+// read. A modified, truncated, swapped or renamed file fails to
+// decrypt and the error is returned by Read, ReadAt or Seek.
+// EncryptDir creates an encrypted directory tree.
+package sivfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+// KeySize is the size of the key of an encrypted file system.
+const KeySize = 32
+
+const (
+	nonceSize = 12
+	overhead  = nonceSize + 16
+)
+
+var (
+	errInvalidName = errors.New("sivfs: invalid encrypted name")
+	errDirectory   = errors.New("sivfs: is a directory")
+)
+
+// FS is a read-only file system that decrypts the files
+// and file names of an underlying file system.
+//
+// FS implements fs.FS, fs.ReadDirFS and fs.StatFS.
+type FS struct {
+	fsys    fs.FS
+	names   *siv.NameCipher
+	content cipher.AEAD
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// New returns a file system that decrypts the encrypted
+// files of fsys using the given key. The key must be
+// KeySize bytes long.
+func New(fsys fs.FS, key []byte) (*FS, error) {
+	if len(key) != KeySize {
+		return nil, aes.KeySizeError(len(key))
+	}
+	names, err := siv.NewNameCipher(deriveKey(sha512.New, key, "siv-go sivfs name"))
+	if err != nil {
+		return nil, err
+	}
+	content, err := siv.NewGCM(deriveKey(sha256.New, key, "siv-go sivfs content"))
+	if err != nil {
+		return nil, err
+	}
+	return &FS{fsys: fsys, names: names, content: content}, nil
+}
+
+func deriveKey(h func() hash.Hash, key []byte, label string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// Open opens the named file. The name is the plaintext
+// name of the file.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	encName, err := fsys.encryptPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.fsys.Open(encName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrap(err)}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrap(err)}
+	}
+	info = newFileInfo(info, path.Base(name))
+	if info.IsDir() {
+		return &dir{fsys: fsys, name: name, f: f, info: info}, nil
+	}
+	return &file{fsys: fsys, name: name, f: f, info: info}, nil
+}
+
+// ReadDir reads the named directory and returns its entries
+// sorted by their decrypted names. It returns an error if
+// any name cannot be decrypted.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	encDir, err := fsys.encryptPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	encEntries, err := fs.ReadDir(fsys.fsys, encDir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: unwrap(err)}
+	}
+	entries := make([]fs.DirEntry, 0, len(encEntries))
+	for _, entry := range encEntries {
+		if isSidecar(entry.Name()) {
+			continue
+		}
+		plaintext, err := fsys.decryptName(encDir, name, entry.Name())
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		entries = append(entries, dirEntry{DirEntry: entry, name: plaintext})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	encName, err := fsys.encryptPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(fsys.fsys, encName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: unwrap(err)}
+	}
+	return newFileInfo(info, path.Base(name)), nil
+}
+
+// encryptPath encrypts each element of the plaintext
+// path name. Long names are not resolved to their
+// sidecar files.
+func (fsys *FS) encryptPath(name string) (string, error) {
+	if name == "." {
+		return name, nil
+	}
+	elements := strings.Split(name, "/")
+	dir := "."
+	for i, element := range elements {
+		encName, _, err := fsys.names.EncryptName([]byte(dir), element)
+		if err != nil {
+			return "", err
+		}
+		elements[i] = encName
+		dir = path.Join(dir, element)
+	}
+	return strings.Join(elements, "/"), nil
+}
+
+// decryptName decrypts the encrypted name of an entry of
+// the directory dir. The encrypted path of dir is encDir.
+func (fsys *FS) decryptName(encDir, dir, encName string) (string, error) {
+	var sidecar []byte
+	if siv.IsLongName(encName) {
+		var err error
+		if sidecar, err = fs.ReadFile(fsys.fsys, path.Join(encDir, encName+siv.LongNameSuffix)); err != nil {
+			return "", errInvalidName
+		}
+	}
+	name, err := fsys.names.DecryptName([]byte(dir), encName, string(sidecar))
+	if err != nil {
+		return "", errInvalidName
+	}
+	return name, nil
+}
+
+// isSidecar reports whether name is the name of a
+// sidecar file containing an encrypted long name.
+func isSidecar(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, siv.LongNamePrefix) && strings.HasSuffix(name, siv.LongNameSuffix)
+}
+
+// EncryptDir encrypts all regular files and directories of src
+// using the given key and writes them to the directory dst. The
+// key must be KeySize bytes long. The directory dst is created
+// if it does not exist.
+func EncryptDir(dst string, src fs.FS, key []byte) error {
+	fsys, err := New(nil, key)
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(src, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return os.MkdirAll(dst, 0755)
+		}
+		target, err := fsys.encryptTarget(dst, name)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		plaintext, err := fs.ReadFile(src, name)
+		if err != nil {
+			return err
+		}
+		ciphertext := make([]byte, nonceSize, overhead+len(plaintext))
+		if _, err = io.ReadFull(rand.Reader, ciphertext); err != nil {
+			return err
+		}
+		ciphertext = fsys.content.Seal(ciphertext, ciphertext, plaintext, []byte(name))
+		return os.WriteFile(target, ciphertext, 0644)
+	})
+}
+
+// encryptTarget returns the path of the encrypted file or
+// directory name within dst. It creates the sidecar file
+// if the encrypted name is a long name.
+func (fsys *FS) encryptTarget(dst, name string) (string, error) {
+	dir := path.Dir(name)
+	encDir, err := fsys.encryptPath(dir)
+	if err != nil {
+		return "", err
+	}
+	encName, sidecar, err := fsys.names.EncryptName([]byte(dir), path.Base(name))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dst, filepath.FromSlash(encDir), encName)
+	if sidecar != "" {
+		if err = os.WriteFile(target+siv.LongNameSuffix, []byte(sidecar), 0644); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// unwrap returns the underlying error of a *fs.PathError
+// such that encrypted names are not exposed.
+func unwrap(err error) error {
+	if pathErr, ok := err.(*fs.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
+
+// file is a regular file that is decrypted on its first read.
+type file struct {
+	fsys *FS
+	name string
+	f    fs.File
+	info fs.FileInfo
+
+	r   *bytes.Reader
+	err error
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Close() error { return f.f.Close() }
+
+func (f *file) Read(b []byte) (int, error) {
+	if err := f.decrypt("read"); err != nil {
+		return 0, err
+	}
+	return f.r.Read(b)
+}
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.decrypt("read"); err != nil {
+		return 0, err
+	}
+	return f.r.ReadAt(b, off)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if err := f.decrypt("seek"); err != nil {
+		return 0, err
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) decrypt(op string) error {
+	if f.r != nil || f.err != nil {
+		return f.err
+	}
+	ciphertext, err := io.ReadAll(f.f)
+	if err != nil {
+		f.err = &fs.PathError{Op: op, Path: f.name, Err: unwrap(err)}
+		return f.err
+	}
+	if len(ciphertext) < overhead {
+		f.err = &fs.PathError{Op: op, Path: f.name, Err: errors.New("sivfs: file too short")}
+		return f.err
+	}
+	plaintext, err := f.fsys.content.Open(ciphertext[nonceSize:nonceSize], ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(f.name))
+	if err != nil {
+		f.err = &fs.PathError{Op: op, Path: f.name, Err: err}
+		return f.err
+	}
+	f.r = bytes.NewReader(plaintext)
+	return nil
+}
+
+// dir is a directory implementing fs.ReadDirFile.
+type dir struct {
+	fsys *FS
+	name string
+	f    fs.File
+	info fs.FileInfo
+
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Close() error { return d.f.Close() }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errDirectory}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		if entries == nil {
+			entries = []fs.DirEntry{}
+		}
+		d.entries = entries
+	}
+	entries := d.entries[d.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
+
+type dirEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e dirEntry) Name() string { return e.name }
+
+func (e dirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(info, e.name), nil
+}
+
+type fileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func newFileInfo(info fs.FileInfo, name string) fs.FileInfo {
+	size := info.Size()
+	if info.Mode().IsRegular() {
+		if size -= overhead; size < 0 {
+			size = 0
+		}
+	}
+	return fileInfo{FileInfo: info, name: name, size: size}
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+func (fi fileInfo) Size() int64 { return fi.size }
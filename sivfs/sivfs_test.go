@@ -0,0 +1,148 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package sivfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	siv "github.com/secure-io/siv-go"
+)
+
+var (
+	longDir  = strings.Repeat("d", 180)
+	longName = longDir + "/" + strings.Repeat("f", 250) + ".txt"
+)
+
+var testFS = fstest.MapFS{
+	longName:              {Data: []byte("file with a long name")},
+	"index.html":          {Data: []byte("<html>index</html>")},
+	"empty.txt":           {Data: []byte{}},
+	"static/app.js":       {Data: []byte("console.log('app')")},
+	"static/css/site.css": {Data: bytes.Repeat([]byte("body{}"), 1000)},
+	"templates/base.tmpl": {Data: []byte("{{ . }}")},
+	"emptydir":            {Mode: fs.ModeDir | 0755},
+}
+
+func encryptTestFS(t *testing.T, key []byte) string {
+	dir := t.TempDir()
+	if err := EncryptDir(dir, testFS, key); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+	return dir
+}
+
+func TestFS(t *testing.T) {
+	key := make([]byte, KeySize)
+	dir := encryptTestFS(t, key)
+
+	fsys, err := New(os.DirFS(dir), key)
+	if err != nil {
+		t.Fatalf("Failed to create file system: %v", err)
+	}
+	if err = fstest.TestFS(fsys, "index.html", "empty.txt", "static/app.js", "static/css/site.css", "templates/base.tmpl", "emptydir", longName); err != nil {
+		t.Fatal(err)
+	}
+	for name, file := range testFS {
+		if file.Mode.IsDir() {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("%s: ReadFile failed: %v", name, err)
+		}
+		if !bytes.Equal(data, file.Data) {
+			t.Fatalf("%s: content mismatch", name)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "index.html")); !os.IsNotExist(err) {
+		t.Fatal("Plaintext file name found in encrypted directory")
+	}
+	err = fs.WalkDir(os.DirFS(dir), ".", func(name string, _ fs.DirEntry, err error) error {
+		if err == nil && strings.ToLower(name) != name {
+			t.Errorf("Encrypted name %q is not lower-case", name)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk encrypted directory: %v", err)
+	}
+	if _, err = fsys.Open("missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Open of missing file: got %v - want %v", err, fs.ErrNotExist)
+	}
+
+	wrongKey := bytes.Repeat([]byte{1}, KeySize)
+	other, _ := New(os.DirFS(dir), wrongKey)
+	if _, err = other.ReadDir("."); err == nil {
+		t.Fatal("ReadDir succeeded with wrong key")
+	}
+}
+
+func TestFSTampering(t *testing.T) {
+	key := make([]byte, KeySize)
+	dir := encryptTestFS(t, key)
+	fsys, _ := New(os.DirFS(dir), key)
+	encPath := func(name string) string {
+		encName, err := fsys.encryptPath(name)
+		if err != nil {
+			t.Fatalf("Failed to encrypt path %q: %v", name, err)
+		}
+		return filepath.Join(dir, filepath.FromSlash(encName))
+	}
+
+	// Modify the content of index.html.
+	data, err := os.ReadFile(encPath("index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	data[nonceSize] ^= 1
+	if err = os.WriteFile(encPath("index.html"), data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	f, err := fsys.Open("index.html")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err = io.ReadAll(f); err == nil {
+		t.Fatal("Read succeeded for modified file")
+	}
+	f.Close()
+
+	// Replace static/app.js with a valid but different file.
+	data, err = os.ReadFile(encPath("templates/base.tmpl"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if err = os.WriteFile(encPath("static/app.js"), data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err = fs.ReadFile(fsys, "static/app.js"); err == nil {
+		t.Fatal("ReadFile succeeded for swapped file")
+	}
+
+	// Move an entry into another directory.
+	if err = os.Rename(encPath("static/css"), filepath.Join(encPath("templates"), filepath.Base(encPath("static/css")))); err != nil {
+		t.Fatalf("Failed to rename directory: %v", err)
+	}
+	if _, err = fsys.ReadDir("templates"); err == nil {
+		t.Fatal("ReadDir succeeded for moved entry")
+	}
+
+	// Replace the sidecar of a long name.
+	sidecar := encPath(longDir) + siv.LongNameSuffix
+	if err = os.WriteFile(sidecar, []byte(strings.Repeat("a", 300)), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+	if _, err = fsys.ReadDir("."); err == nil {
+		t.Fatal("ReadDir succeeded for modified sidecar")
+	}
+}
@@ -175,4 +175,19 @@ var aesGcmSivTests = []vector{
 		nonce:          "688089e55540db1872504e1c",
 		ciphertext:     "626660c26ea6612fb17ad91e8e767639edd6c9faee9d6c7029675b89eaf4ba1ded1a286594",
 	},
+	// Counter wrap (RFC 8452, C.3)
+	{
+		key:            "0000000000000000000000000000000000000000000000000000000000000000",
+		plaintext:      "000000000000000000000000000000004db923dc793ee6497c76dcc03a98e108",
+		additionalData: "",
+		nonce:          "000000000000000000000000",
+		ciphertext:     "f3f80f2cf0cb2dd9c5984fcda908456cc537703b5ba70324a6793a7bf218d3eaffffffff000000000000000000000000",
+	},
+	{
+		key:            "0000000000000000000000000000000000000000000000000000000000000000",
+		plaintext:      "eb3640277c7ffd1303c7a542d02d3e4c0000000000000000",
+		additionalData: "",
+		nonce:          "000000000000000000000000",
+		ciphertext:     "18ce4f0b8cb4d0cac65fea8f79257b20888e53e72299e56dffffffff000000000000000000000000",
+	},
 }
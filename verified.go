@@ -0,0 +1,116 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// ErrSealVerification is returned by a VerifiedAEAD when a
+// freshly sealed ciphertext cannot be verified - e.g. due to
+// a hardware fault.
+var ErrSealVerification = errors.New("siv: verification of sealed ciphertext failed")
+
+// VerifiedAEAD is an AEAD that verifies every ciphertext before
+// returning it. After sealing a message with the fastest backend
+// it opens the ciphertext again using the generic backend and
+// compares the result with the plaintext in constant time. If
+// the generic backend rejects the ciphertext or returns a
+// different plaintext, Seal wipes the ciphertext and returns
+// ErrSealVerification. Hence, a faulty AES computation - caused
+// e.g. by glitching or a defective CPU core - does not leak a
+// malformed ciphertext.
+//
+// The generic backend uses a table-based software AES of this
+// package and a pure Go POLYVAL - not crypto/aes, which uses the
+// AES-NI instructions of the CPU, too. Therefore, a fault of the
+// AES-NI or PCLMULQDQ instructions cannot affect both computations
+// in the same way. If the CPU does not support any assembler
+// backend, both computations use the generic backend. Then, a
+// VerifiedAEAD only detects transient faults.
+//
+// Verifying a ciphertext costs as much as opening it with the
+// generic backend. In particular, the software AES and the generic
+// POLYVAL computation are much slower than their AES-NI resp.
+// PCLMULQDQ-based counterparts such that a verified Seal is
+// significantly slower than an unverified one.
+type VerifiedAEAD struct {
+	aead     cipher.AEAD
+	verifier cipher.AEAD
+}
+
+// NewVerifiedCMAC returns a VerifiedAEAD implementing
+// AES-SIV-CMAC. The key must be either 32, 48 or 64 bytes
+// long.
+func NewVerifiedCMAC(key []byte) (*VerifiedAEAD, error) {
+	c, err := NewCMAC(key)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newCMACGeneric(key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedAEAD{aead: c, verifier: &aesSivCMac{verifier}}, nil
+}
+
+// NewVerifiedGCM returns a VerifiedAEAD implementing
+// AES-GCM-SIV. The key must be either 16 or 32 bytes
+// long.
+func NewVerifiedGCM(key []byte) (*VerifiedAEAD, error) {
+	c, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newGCMGeneric(key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedAEAD{aead: c, verifier: &aesGcmSiv{verifier}}, nil
+}
+
+// NonceSize returns the size of the nonce that must be passed
+// to Seal and Open.
+func (c *VerifiedAEAD) NonceSize() int { return c.aead.NonceSize() }
+
+// Overhead returns the maximum difference between the lengths
+// of a plaintext and its ciphertext.
+func (c *VerifiedAEAD) Overhead() int { return c.aead.Overhead() }
+
+// Seal encrypts and authenticates plaintext like cipher.AEAD.Seal.
+// It returns ErrSealVerification if the ciphertext cannot be
+// verified.
+func (c *VerifiedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	// Sealing in place overwrites the plaintext which
+	// is needed to verify the ciphertext.
+	if anyOverlap(dst[len(dst):cap(dst)], plaintext) {
+		plaintext = append(make([]byte, 0, len(plaintext)), plaintext...)
+		defer wipe(plaintext)
+	}
+	ret := c.aead.Seal(dst, nonce, plaintext, additionalData)
+	ciphertext := ret[len(dst):]
+
+	p, err := c.verifier.Open(make([]byte, 0, len(plaintext)), nonce, ciphertext, additionalData)
+	if err != nil || subtle.ConstantTimeCompare(p, plaintext) != 1 {
+		wipe(p[:cap(p)])
+		wipe(ciphertext)
+		return nil, ErrSealVerification
+	}
+	wipe(p)
+	return ret, nil
+}
+
+// Open decrypts and authenticates ciphertext like cipher.AEAD.Open.
+func (c *VerifiedAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return c.aead.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// Destroy wipes all key material. See Destroyer.
+func (c *VerifiedAEAD) Destroy() {
+	c.aead.(Destroyer).Destroy()
+	c.verifier.(Destroyer).Destroy()
+}
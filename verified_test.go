@@ -0,0 +1,129 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package siv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+)
+
+// faultyAEAD flips one bit of every ciphertext.
+type faultyAEAD struct{ cipher.AEAD }
+
+func (c faultyAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	ret := c.AEAD.Seal(dst, nonce, plaintext, additionalData)
+	ret[len(ret)-1] ^= 1
+	return ret
+}
+
+// faultyOpenAEAD flips one bit of every plaintext.
+type faultyOpenAEAD struct{ cipher.AEAD }
+
+func (c faultyOpenAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	ret, err := c.AEAD.Open(dst, nonce, ciphertext, additionalData)
+	if err == nil && len(ret) > len(dst) {
+		ret[len(ret)-1] ^= 1
+	}
+	return ret, err
+}
+
+func TestVerifiedAEAD(t *testing.T) {
+	cmac, err := NewVerifiedCMAC(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Failed to create verified AES-SIV-CMAC: %v", err)
+	}
+	gcm, err := NewVerifiedGCM(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("Failed to create verified AES-GCM-SIV: %v", err)
+	}
+
+	plaintext, additionalData := []byte("plaintext"), []byte("additional data")
+	for i, c := range []*VerifiedAEAD{cmac, gcm} {
+		nonce := make([]byte, c.NonceSize())
+		ciphertext, err := c.Seal(nil, nonce, plaintext, additionalData)
+		if err != nil {
+			t.Fatalf("Test %d: Seal failed: %v", i, err)
+		}
+		if p, err := c.Open(nil, nonce, ciphertext, additionalData); err != nil || !bytes.Equal(p, plaintext) {
+			t.Fatalf("Test %d: Open failed: %v", i, err)
+		}
+
+		// Seal must also verify in-place encryption.
+		buf := make([]byte, len(plaintext), len(plaintext)+c.Overhead())
+		copy(buf, plaintext)
+		if sealed, err := c.Seal(buf[:0], nonce, buf, additionalData); err != nil || !bytes.Equal(sealed, ciphertext) {
+			t.Fatalf("Test %d: in-place Seal failed: %v", i, err)
+		}
+
+		// A verifier that returns a different plaintext must
+		// fail the verification - even if it authenticates.
+		verifier := c.verifier
+		c.verifier = faultyOpenAEAD{verifier}
+		if _, err = c.Seal(nil, nonce, plaintext, additionalData); err != ErrSealVerification {
+			t.Fatalf("Test %d: Seal with wrong plaintext: got %v - want %v", i, err, ErrSealVerification)
+		}
+		c.verifier = verifier
+
+		c.aead = faultyAEAD{c.aead}
+		dst := make([]byte, 0, len(plaintext)+c.Overhead())
+		if _, err = c.Seal(dst, nonce, plaintext, additionalData); err != ErrSealVerification {
+			t.Fatalf("Test %d: Seal: got %v - want %v", i, err, ErrSealVerification)
+		}
+		if dst = dst[:cap(dst)]; !bytes.Equal(dst, make([]byte, len(dst))) {
+			t.Fatalf("Test %d: faulty ciphertext has not been wiped: %x", i, dst)
+		}
+	}
+}
+
+func BenchmarkAES128VerifiedCMACSeal64(b *testing.B) {
+	benchmarkVerifiedCMACSeal(make([]byte, 32), 64, b)
+}
+func BenchmarkAES128VerifiedCMACSeal1K(b *testing.B) {
+	benchmarkVerifiedCMACSeal(make([]byte, 32), 1024, b)
+}
+func BenchmarkAES128VerifiedCMACSeal8K(b *testing.B) {
+	benchmarkVerifiedCMACSeal(make([]byte, 32), 8*1024, b)
+}
+
+func BenchmarkAES128VerifiedGCMSeal64(b *testing.B) {
+	benchmarkVerifiedGCMSeal(make([]byte, 16), 64, b)
+}
+func BenchmarkAES128VerifiedGCMSeal1K(b *testing.B) {
+	benchmarkVerifiedGCMSeal(make([]byte, 16), 1024, b)
+}
+func BenchmarkAES128VerifiedGCMSeal8K(b *testing.B) {
+	benchmarkVerifiedGCMSeal(make([]byte, 16), 8*1024, b)
+}
+
+func benchmarkVerifiedCMACSeal(key []byte, size int64, b *testing.B) {
+	c, err := NewVerifiedCMAC(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkVerifiedSeal(c, size, b)
+}
+
+func benchmarkVerifiedGCMSeal(key []byte, size int64, b *testing.B) {
+	c, err := NewVerifiedGCM(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkVerifiedSeal(c, size, b)
+}
+
+func benchmarkVerifiedSeal(c *VerifiedAEAD, size int64, b *testing.B) {
+	nonce := make([]byte, c.NonceSize())
+	plaintext := make([]byte, size)
+	ciphertext := make([]byte, len(plaintext)+c.Overhead())
+
+	b.ResetTimer()
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Seal(ciphertext[:0], nonce, plaintext, nil); err != nil {
+			panic(err)
+		}
+	}
+}